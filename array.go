@@ -0,0 +1,135 @@
+package wasmvm
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// newArrayClass returns the Array class. Arrays created by the guest are
+// *[]interface{}, so they keep their identity when they grow. Go slices and
+// arrays passed by the host, or pointers to them, are arrays too.
+func newArrayClass() *Class {
+	return &Class{
+		Name: "Array",
+		New: func(items ...interface{}) (*[]interface{}, error) {
+			// new Array(n) creates an array of n empty slots.
+			if len(items) == 1 {
+				if n, ok := items[0].(float64); ok {
+					if n < 0 || n > math.MaxInt32 || n != math.Trunc(n) {
+						return nil, &Error{Message: "Invalid array length"}
+					}
+					a := make([]interface{}, int(n))
+					for i := range a {
+						a[i] = Undefined
+					}
+					return &a, nil
+				}
+			}
+
+			a := append([]interface{}{}, items...)
+			return &a, nil
+		},
+		Static: map[string]interface{}{
+			"isArray": func(v interface{}) bool {
+				_, ok := arrayOf(v)
+				return ok
+			},
+		},
+		instance: func(v interface{}) bool {
+			_, ok := arrayOf(v)
+			return ok
+		},
+	}
+}
+
+// arrayOf returns the Go slice or array v holds, dereferencing pointers to
+// them so they can be modified in place.
+func arrayOf(v interface{}) (reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return rv, true
+	}
+
+	return reflect.Value{}, false
+}
+
+// index returns v[i], or undefined when v is not an array or i is out of
+// range.
+func index(v interface{}, i int) interface{} {
+	switch o := v.(type) {
+	case JSObject:
+		return o.Index(i)
+	case *TypedArray:
+		return o.index(i)
+	}
+
+	a, ok := arrayOf(v)
+	if !ok || i < 0 || i >= a.Len() || !a.Index(i).CanInterface() {
+		return Undefined
+	}
+
+	return a.Index(i).Interface()
+}
+
+// setIndex sets v[i] = x, where v is the value referenced by id. Like
+// JavaScript arrays, slices grow when i is past their end, with the new
+// elements set to undefined if they can hold it. A slice that is not behind
+// a pointer cannot grow in place, so the guest reference is updated to point
+// to the grown copy.
+func (inst *Instance) setIndex(id uint32, v interface{}, i int, x interface{}) error {
+	switch o := v.(type) {
+	case JSObject:
+		o.Set(strconv.Itoa(i), x)
+		return nil
+	case *TypedArray:
+		o.setIndex(i, x)
+		return nil
+	}
+
+	a, ok := arrayOf(v)
+	if !ok {
+		return fmt.Errorf("%s is not an array", jsString(v))
+	}
+	if i < 0 {
+		return fmt.Errorf("invalid array index %d", i)
+	}
+
+	elem, err := convertValue(x, a.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	if i >= a.Len() {
+		if a.Kind() != reflect.Slice {
+			return fmt.Errorf("index %d out of range for a fixed size array", i)
+		}
+
+		grown := reflect.AppendSlice(a, reflect.MakeSlice(a.Type(), i+1-a.Len(), i+1-a.Len()))
+		if undef := reflect.ValueOf(Undefined); undef.Type().AssignableTo(a.Type().Elem()) {
+			for j := a.Len(); j < i; j++ {
+				grown.Index(j).Set(undef)
+			}
+		}
+
+		if a.CanSet() {
+			a.Set(grown)
+		} else {
+			inst.refs.replace(id, grown.Interface())
+		}
+		a = grown
+	}
+
+	if !a.Index(i).CanSet() {
+		return fmt.Errorf("%s is read-only", jsString(v))
+	}
+	a.Index(i).Set(elem)
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package wasmvm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetIndexGrowsHostSlices(t *testing.T) {
+	inst := newInstance(NewRuntime(Options{}))
+
+	s := []string{"a"}
+	id := inst.refs.ref(s)
+	if err := inst.setIndex(id, s, 2, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if got := inst.refs.get(id); !reflect.DeepEqual(got, []string{"a", "", "c"}) {
+		t.Errorf("reference holds %q after growing", got)
+	}
+
+	p := &[]interface{}{1.0}
+	id = inst.refs.ref(p)
+	if err := inst.setIndex(id, p, 2, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{1.0, Undefined, "c"}; !reflect.DeepEqual(*p, want) {
+		t.Errorf("slice is %v, want %v", *p, want)
+	}
+	if inst.refs.get(id) != p {
+		t.Error("pointer reference replaced")
+	}
+
+	fixed := &[2]int{}
+	if err := inst.setIndex(inst.refs.ref(fixed), fixed, 1, 5.0); err != nil || fixed[1] != 5 {
+		t.Errorf("fixed[1] = %d, %v", fixed[1], err)
+	}
+	if err := inst.setIndex(inst.refs.ref(fixed), fixed, 2, 5.0); err == nil {
+		t.Error("fixed size array grew")
+	}
+}
+
+func TestHostFuncsTakeGuestArrays(t *testing.T) {
+	sum := func(values []float64) float64 {
+		total := 0.0
+		for _, v := range values {
+			total += v
+		}
+		return total
+	}
+
+	res, err := callFunc(sum, nil, []interface{}{&[]interface{}{1.0, 2.0, 3.0}})
+	if err != nil || res != 6.0 {
+		t.Errorf("sum returned %v, %v", res, err)
+	}
+}
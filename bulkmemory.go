@@ -0,0 +1,169 @@
+package wasmvm
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/go-interpreter/wagon/wasm/leb128"
+)
+
+// Since Go 1.21 the compiler emits memory.copy and memory.fill from the
+// bulk memory proposal, which wagon does not know about. lowerBulkMemory
+// rewrites both instructions into calls to host functions appended to the
+// function index space, so modules built by newer toolchains still run.
+func lowerBulkMemory(m *wasm.Module) error {
+	if m.Types == nil || m.Function == nil {
+		return nil
+	}
+
+	copyIdx := uint64(len(m.FunctionIndexSpace))
+	fillIdx := copyIdx + 1
+	lowered := false
+
+	for i := range m.FunctionIndexSpace {
+		fn := &m.FunctionIndexSpace[i]
+		if fn.IsHost() || fn.Body == nil {
+			continue
+		}
+
+		code, changed, err := lowerBulkMemoryCode(fn.Body.Code, copyIdx, fillIdx)
+		if err != nil {
+			return fmt.Errorf("function %d: %v", i, err)
+		}
+
+		if changed {
+			fn.Body.Code = code
+			lowered = true
+		}
+	}
+
+	if !lowered {
+		return nil
+	}
+
+	m.Types.Entries = append(m.Types.Entries, wasm.FunctionSig{
+		Form:       0x60,
+		ParamTypes: []wasm.ValueType{wasm.ValueTypeI32, wasm.ValueTypeI32, wasm.ValueTypeI32},
+	})
+	typeIdx := uint32(len(m.Types.Entries) - 1)
+	sig := &m.Types.Entries[typeIdx]
+
+	// disasm looks signatures up through the function section, so the new
+	// functions need an entry there as well.
+	m.Function.Types = append(m.Function.Types, typeIdx, typeIdx)
+	m.FunctionIndexSpace = append(m.FunctionIndexSpace,
+		wasm.Function{Sig: sig, Host: reflect.ValueOf(memoryCopy), Body: &wasm.FunctionBody{}},
+		wasm.Function{Sig: sig, Host: reflect.ValueOf(memoryFill), Body: &wasm.FunctionBody{}},
+	)
+
+	return nil
+}
+
+func lowerBulkMemoryCode(code []byte, copyIdx, fillIdx uint64) ([]byte, bool, error) {
+	var out []byte
+	last := 0
+	pc := 0
+
+	for pc < len(code) {
+		start := pc
+		op := code[pc]
+		pc++
+
+		switch {
+		case op == 0x02 || op == 0x03 || op == 0x04: // block, loop, if
+			pc++
+		case op == 0x0c || op == 0x0d || op == 0x10: // br, br_if, call
+			pc = skipLEB128(code, pc)
+		case op == 0x0e: // br_table
+			n, l := readULEB128(code[pc:])
+			pc += l
+			for i := uint64(0); i <= n; i++ {
+				pc = skipLEB128(code, pc)
+			}
+		case op == 0x11: // call_indirect
+			pc = skipLEB128(code, pc) + 1
+		case op >= 0x20 && op <= 0x24: // local.*, global.*
+			pc = skipLEB128(code, pc)
+		case op >= 0x28 && op <= 0x3e: // loads and stores
+			pc = skipLEB128(code, skipLEB128(code, pc))
+		case op == 0x3f || op == 0x40: // memory.size, memory.grow
+			pc++
+		case op == 0x41 || op == 0x42: // i32.const, i64.const
+			pc = skipLEB128(code, pc)
+		case op == 0x43: // f32.const
+			pc += 4
+		case op == 0x44: // f64.const
+			pc += 8
+		case op == 0xfc:
+			sub, l := readULEB128(code[pc:])
+			pc += l
+
+			var target uint64
+			switch sub {
+			case 10: // memory.copy
+				pc += 2
+				target = copyIdx
+			case 11: // memory.fill
+				pc++
+				target = fillIdx
+			default:
+				return nil, false, fmt.Errorf("unsupported instruction 0xfc %d", sub)
+			}
+
+			out = append(out, code[last:start]...)
+			out = append(out, 0x10)
+			out = leb128.AppendUleb128(out, target)
+			last = pc
+		}
+	}
+
+	if out == nil {
+		return code, false, nil
+	}
+
+	return append(out, code[last:]...), true, nil
+}
+
+func memoryCopy(proc *exec.Process, dst, src, n int32) {
+	data := make([]byte, uint32(n))
+	if _, err := proc.ReadAt(data, int64(uint32(src))); err != nil {
+		panic(exec.ErrOutOfBoundsMemoryAccess)
+	}
+	if _, err := proc.WriteAt(data, int64(uint32(dst))); err != nil {
+		panic(exec.ErrOutOfBoundsMemoryAccess)
+	}
+}
+
+func memoryFill(proc *exec.Process, dst, val, n int32) {
+	data := make([]byte, uint32(n))
+	for i := range data {
+		data[i] = byte(val)
+	}
+	if _, err := proc.WriteAt(data, int64(uint32(dst))); err != nil {
+		panic(exec.ErrOutOfBoundsMemoryAccess)
+	}
+}
+
+func skipLEB128(code []byte, pc int) int {
+	for pc < len(code) && code[pc]&0x80 != 0 {
+		pc++
+	}
+	return pc + 1
+}
+
+func readULEB128(b []byte) (uint64, int) {
+	var v uint64
+	var shift uint
+
+	for i, c := range b {
+		v |= uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, i + 1
+		}
+		shift += 7
+	}
+
+	return v, len(b)
+}
@@ -0,0 +1,143 @@
+package wasmvm
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time of an instance: what the guest reads as the time, and
+// what its timers wait for.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Timer returns a channel that receives the time once it is t or later,
+	// and a function stopping the timer if it is no longer needed.
+	Timer(t time.Time) (<-chan time.Time, func())
+	// Idle is called when the guest has nothing to do but wait for its
+	// timer at t. The time may jump there.
+	Idle(t time.Time)
+}
+
+// RealClock is the clock of the host. Its zero value is ready to use.
+type RealClock struct{}
+
+// Now implements Clock.
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// Timer implements Clock.
+func (RealClock) Timer(t time.Time) (<-chan time.Time, func()) {
+	timer := time.NewTimer(time.Until(t))
+	return timer.C, func() { timer.Stop() }
+}
+
+// Idle implements Clock. The real clock waits for time to pass.
+func (RealClock) Idle(t time.Time) {}
+
+// instanceClock is the clock of inst, even once SetClock replaces it.
+type instanceClock struct {
+	inst *Instance
+}
+
+// Now implements Clock.
+func (c instanceClock) Now() time.Time {
+	return c.inst.clock.Now()
+}
+
+// Timer implements Clock.
+func (c instanceClock) Timer(t time.Time) (<-chan time.Time, func()) {
+	return c.inst.clock.Timer(t)
+}
+
+// Idle implements Clock.
+func (c instanceClock) Idle(t time.Time) {
+	c.inst.clock.Idle(t)
+}
+
+// VirtualClock is a clock that only moves when told to, or when a guest using
+// it is idle, to the time its next timer fires. A guest sleeping for an hour
+// is done right away, while the hour shows in the time it reads. Instances
+// may share a VirtualClock, and each of them moves it.
+type VirtualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*virtualTimer
+}
+
+// virtualTimer is a pending timer of a VirtualClock.
+type virtualTimer struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewVirtualClock returns a VirtualClock starting at start.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start.Round(0)}
+}
+
+// Now implements Clock.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the time forward by d, firing the timers due by then. It
+// does nothing if d is negative: time never goes back.
+func (c *VirtualClock) Advance(d time.Duration) {
+	if d > 0 {
+		c.advanceTo(c.Now().Add(d))
+	}
+}
+
+// advanceTo moves the time forward to t, if it is later.
+func (c *VirtualClock) advanceTo(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !t.After(c.now) {
+		return
+	}
+	c.now = t
+
+	sort.Slice(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+	n := 0
+	for n < len(c.timers) && !c.timers[n].at.After(t) {
+		c.timers[n].c <- t
+		n++
+	}
+	c.timers = append(c.timers[:0], c.timers[n:]...)
+}
+
+// Timer implements Clock.
+func (c *VirtualClock) Timer(t time.Time) (<-chan time.Time, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &virtualTimer{at: t, c: make(chan time.Time, 1)}
+	if !t.After(c.now) {
+		timer.c <- c.now
+		return timer.c, func() {}
+	}
+	c.timers = append(c.timers, timer)
+
+	return timer.c, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for i, other := range c.timers {
+			if other == timer {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Idle implements Clock by jumping to t.
+func (c *VirtualClock) Idle(t time.Time) {
+	c.advanceTo(t)
+}
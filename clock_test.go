@@ -0,0 +1,154 @@
+package wasmvm
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/clock/main.wasm ./testdata/clock
+
+var clockStart = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// A guest on a virtual clock sleeps for an hour at once.
+func TestVirtualClock(t *testing.T) {
+	begin := time.Now()
+	got := runWith(t, Options{Clock: NewVirtualClock(clockStart)}, "testdata/clock/main.wasm", nil)
+	if elapsed := time.Since(begin); elapsed > 30*time.Second {
+		t.Errorf("took %v", elapsed)
+	}
+
+	want := "start: 2000-01-01T00:00:00Z\n" +
+		"timer after 30m0s\n" +
+		"end: 2000-01-01T01:00:00Z\n" +
+		"slept 1h0m0s, wall clock moved 1h0m0s\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// The MemFS of an instance stamps files with the time on its clock.
+func TestVirtualClockFileTimes(t *testing.T) {
+	clock := NewVirtualClock(clockStart)
+	inst := loadWasm(t, NewRuntime(Options{Clock: clock}), "testdata/clock/main.wasm")
+	fs := inst.files.fs
+
+	if err := writeFile(fs, "/file", strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("/file"); err != nil || !fi.ModTime().Equal(clockStart) {
+		t.Errorf("mtime: %v, %v, want %v", fi, err, clockStart)
+	}
+
+	// The instance may get another clock once it exists.
+	later := clockStart.Add(time.Hour)
+	inst.SetClock(NewVirtualClock(later))
+	if err := fs.Chmod("/file", 0600); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := fs.Stat("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := fi.Sys().(*FileStat); !st.Ctime.Equal(later) || !fi.ModTime().Equal(clockStart) {
+		t.Errorf("after chmod: ctime %v, mtime %v", st.Ctime, fi.ModTime())
+	}
+}
+
+// A guest that is not idle, here waiting for input, waits for the time to be
+// moved forward.
+func TestVirtualClockAdvance(t *testing.T) {
+	clock := NewVirtualClock(clockStart)
+	r, w := io.Pipe()
+	defer w.Close()
+
+	// Once the guest is under way, move the time a minute at a time.
+	var advanced, done int32
+	advance := func() {
+		for atomic.LoadInt32(&done) == 0 {
+			clock.Advance(time.Minute)
+			atomic.AddInt32(&advanced, 1)
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	got := runWith(t, Options{Clock: clock, Stdin: r}, "testdata/clock/main.wasm", []string{"clock", "stdin"}, func(inst *Instance) {
+		console := inst.global["console"].(map[string]interface{})
+		log := console["log"].(func(string))
+		console["log"] = func(line string) {
+			if strings.HasPrefix(line, "start: ") {
+				go advance()
+			}
+			if strings.HasPrefix(line, "end: ") && atomic.LoadInt32(&advanced) < 60 {
+				t.Errorf("woke up after %d minutes", atomic.LoadInt32(&advanced))
+			}
+			log(line)
+		}
+	})
+	atomic.StoreInt32(&done, 1)
+
+	lines := strings.Split(got, "\n")
+	if len(lines) != 5 || lines[0] != "start: 2000-01-01T00:00:00Z" || !strings.HasPrefix(lines[1], "timer after 3") {
+		t.Fatalf("got:\n%s", got)
+	}
+	fields := strings.Fields(lines[3])
+	slept, err := time.ParseDuration(strings.TrimSuffix(fields[1], ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	moved, err := time.ParseDuration(fields[len(fields)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slept < time.Hour || slept > time.Hour+2*time.Minute || moved != slept {
+		t.Errorf("slept %v, wall clock moved %v", slept, moved)
+	}
+}
+
+func TestVirtualClockTimers(t *testing.T) {
+	clock := NewVirtualClock(clockStart)
+
+	late, stopLate := clock.Timer(clockStart.Add(time.Hour))
+	defer stopLate()
+	soon, _ := clock.Timer(clockStart.Add(time.Second))
+	stopped, stop := clock.Timer(clockStart.Add(time.Second))
+	stop()
+
+	clock.Advance(-time.Hour)
+	clock.Advance(time.Minute)
+	if got := clock.Now(); !got.Equal(clockStart.Add(time.Minute)) {
+		t.Errorf("now %v", got)
+	}
+
+	select {
+	case at := <-soon:
+		if !at.Equal(clockStart.Add(time.Minute)) {
+			t.Errorf("fired at %v", at)
+		}
+	default:
+		t.Error("timer due did not fire")
+	}
+	select {
+	case <-late:
+		t.Error("timer not due fired")
+	case <-stopped:
+		t.Error("stopped timer fired")
+	default:
+	}
+
+	past, _ := clock.Timer(clockStart)
+	select {
+	case <-past:
+	default:
+		t.Error("timer in the past did not fire")
+	}
+
+	clock.Idle(clockStart.Add(time.Hour))
+	select {
+	case <-late:
+	default:
+		t.Error("idle clock did not jump to the timer")
+	}
+}
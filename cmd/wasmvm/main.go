@@ -0,0 +1,356 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-interpreter/wagon/validate"
+	"github.com/go-interpreter/wagon/wasm"
+	"github.com/racerxdl/wasmvm"
+)
+
+// listFlag collects the values of a flag that can be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	var dirs, archives, overlays, envs, envFiles listFlag
+	flag.Var(&dirs, "dir", "give the guest the host `directory` given as host[:guest][:ro]; repeatable")
+	flag.Var(&archives, "archive", "mount the zip or tar `file` given as file:guest read-only; repeatable")
+	flag.Var(&overlays, "overlay", "put a writable overlay on the `mount` given as guest[:changes.tar], exporting the changes to the tar file if given; repeatable")
+	inheritEnv := flag.Bool("inherit-env", false, "give the guest the environment of the host")
+	flag.Var(&envFiles, "env-file", "set the environment variables in `file`, one KEY=value per line; repeatable")
+	flag.Var(&envs, "env", "set the environment `variable` given as KEY=value, or KEY for the value on the host; repeatable")
+	workdir := flag.String("workdir", "/", "the working `directory` of the guest")
+	pid := flag.Int("pid", 1, "the process `ID` of the guest")
+	ppid := flag.Int("ppid", 0, "the parent process `ID` of the guest")
+	user := flag.String("user", "0:0", "run the guest as `uid[:gid[:group,...]]`")
+	umask := flag.String("umask", "022", "the `umask` of the guest, in octal")
+	maxOpenFiles := flag.Int("max-open-files", 1024, "the `number` of files the guest may have open at once")
+	output := flag.String("output", "raw", "write the output of the guest as `format` raw, prefix or json")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] module.wasm [args...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	id, err := identity(*user, *umask)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	env, err := environ(*inheritEnv, envFiles, envs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	format, ok := outputFormats[*output]
+	if !ok {
+		log.Fatalf("invalid --output %q, want raw, prefix or json", *output)
+	}
+
+	fs, layers, err := mount(dirs, archives, overlays)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rt := wasmvm.NewRuntime(wasmvm.Options{
+		Resolve:  importer,
+		FS:       fs,
+		Env:      env,
+		Stdin:    os.Stdin,
+		Identity: id,
+		Dir:      *workdir,
+		PID:      *pid,
+		PPID:     *ppid,
+
+		MaxOpenFiles: *maxOpenFiles,
+		OutputFormat: format,
+	})
+
+	inst, err := rt.Load(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = inst.Run(context.Background(), flag.Args())
+	for _, l := range layers {
+		if err := l.export(); err != nil {
+			log.Print(err)
+		}
+	}
+	var exit *wasmvm.ExitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.Code)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// outputFormats are the values of the --output flag.
+var outputFormats = map[string]wasmvm.OutputFormat{
+	"raw":    wasmvm.OutputRaw,
+	"prefix": wasmvm.OutputPrefixed,
+	"json":   wasmvm.OutputJSON,
+}
+
+// identity parses the --user and --umask flags. The group defaults to the
+// user ID.
+func identity(user, umask string) (wasmvm.Identity, error) {
+	var id wasmvm.Identity
+	bad := fmt.Errorf("invalid --user %q, want uid[:gid[:group,...]]", user)
+
+	parts := strings.SplitN(user, ":", 3)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return id, bad
+	}
+	id.UID, id.GID = uid, uid
+
+	if len(parts) > 1 {
+		if id.GID, err = strconv.Atoi(parts[1]); err != nil {
+			return id, bad
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		for _, group := range strings.Split(parts[2], ",") {
+			gid, err := strconv.Atoi(group)
+			if err != nil {
+				return id, bad
+			}
+			id.Groups = append(id.Groups, gid)
+		}
+	}
+
+	mask, err := strconv.ParseUint(umask, 8, 32)
+	if err != nil {
+		return id, fmt.Errorf("invalid --umask %q", umask)
+	}
+	id.Umask = os.FileMode(mask) & os.ModePerm
+
+	return id, nil
+}
+
+// environ returns the environment of the guest: the one of the host if
+// inherit is set, then the variables in files, then vars, each overriding the
+// previous ones. Blank lines and lines starting with # in files are skipped.
+func environ(inherit bool, files, vars []string) (map[string]string, error) {
+	env := map[string]string{}
+	set := func(kv string) {
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			env[kv[:i]] = kv[i+1:]
+		} else if value, ok := os.LookupEnv(kv); ok {
+			env[kv] = value
+		}
+	}
+
+	if inherit {
+		for _, kv := range os.Environ() {
+			set(kv)
+		}
+	}
+
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				set(line)
+			}
+		}
+	}
+
+	for _, kv := range vars {
+		set(kv)
+	}
+
+	return env, nil
+}
+
+// layer is an overlay put on a mount with --overlay.
+type layer struct {
+	fs   *wasmvm.OverlayFS
+	file string
+}
+
+// export writes the changes made to the overlay to its file, if it has one.
+// Otherwise they are discarded.
+func (l layer) export() error {
+	if l.file == "" {
+		return l.fs.Discard()
+	}
+
+	f, err := os.Create(l.file)
+	if err != nil {
+		return err
+	}
+	if err := l.fs.Export(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// mount returns an in-memory filesystem with the host directories and the
+// archives mounted. Each directory is given as host[:guest][:ro]; the guest
+// path defaults to the host path, made absolute, and ro mounts the directory
+// read-only. Archives are given as file:guest. Overlays, given as
+// guest[:changes.tar], are put on top of what is mounted at guest, which is
+// left untouched.
+func mount(dirs, archives, overlays []string) (wasmvm.FS, []layer, error) {
+	fs := wasmvm.NewMountFS(wasmvm.NewMemFS())
+	mounted := map[string]wasmvm.FS{}
+
+	for _, dir := range dirs {
+		parts := strings.Split(dir, ":")
+		readOnly := false
+		if n := len(parts); n > 1 && (parts[n-1] == "ro" || parts[n-1] == "rw") {
+			readOnly = parts[n-1] == "ro"
+			parts = parts[:n-1]
+		}
+		if len(parts) > 2 || parts[0] == "" {
+			return nil, nil, fmt.Errorf("invalid --dir %q, want host[:guest][:ro]", dir)
+		}
+
+		host := parts[0]
+		guest := host
+		if len(parts) == 2 {
+			guest = parts[1]
+		} else if abs, err := filepath.Abs(host); err == nil {
+			guest = filepath.ToSlash(abs)
+		}
+
+		hostFS, err := wasmvm.NewHostFS(host, readOnly)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := fs.Mount(guest, hostFS); err != nil {
+			return nil, nil, err
+		}
+		mounted[path.Join("/", guest)] = hostFS
+	}
+
+	for _, archive := range archives {
+		i := strings.LastIndex(archive, ":")
+		if i < 0 {
+			return nil, nil, fmt.Errorf("invalid --archive %q, want file:guest", archive)
+		}
+
+		archiveFS, err := openArchive(archive[:i])
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := fs.Mount(archive[i+1:], archiveFS); err != nil {
+			return nil, nil, err
+		}
+		mounted[path.Join("/", archive[i+1:])] = archiveFS
+	}
+
+	var layers []layer
+	for _, overlay := range overlays {
+		guest, file := overlay, ""
+		if i := strings.Index(overlay, ":"); i >= 0 {
+			guest, file = overlay[:i], overlay[i+1:]
+		}
+		guest = path.Join("/", guest)
+
+		lower, ok := mounted[guest]
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid --overlay %q, %s is not mounted with --dir or --archive", overlay, guest)
+		}
+
+		l := layer{fs: wasmvm.NewOverlayFS(lower, nil), file: file}
+		if err := fs.Mount(guest, l.fs); err != nil {
+			return nil, nil, err
+		}
+		layers = append(layers, l)
+	}
+
+	return fs, layers, nil
+}
+
+// openArchive returns a read-only filesystem with the files of the zip, tar
+// or gzipped tar archive name.
+func openArchive(name string) (wasmvm.FS, error) {
+	if strings.HasSuffix(name, ".zip") {
+		// The archive stays open for the life of the process.
+		z, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, err
+		}
+		return wasmvm.NewIOFS(z), nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case strings.HasSuffix(name, ".tar"):
+	default:
+		return nil, fmt.Errorf("%s: unknown archive type, want .zip, .tar, .tar.gz or .tgz", name)
+	}
+
+	return wasmvm.NewTarFS(r)
+}
+
+func importer(name string) (*wasm.Module, error) {
+	f, err := os.Open(name + ".wasm")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := wasm.ReadModule(f, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = validate.VerifyModule(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,99 @@
+package wasmvm
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/jsapi/main.wasm ./testdata/jsapi
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/arrays/main.wasm ./testdata/arrays
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/typedarrays/main.wasm ./testdata/typedarrays
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/fs/main.wasm ./testdata/fs
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/links/main.wasm ./testdata/links
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/fds/main.wasm ./testdata/fds
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/cwd/main.wasm ./testdata/cwd
+
+// The programs in testdata log through console.log, and want.txt holds what
+// they log when run by Node.js with the wasm_exec.js of the Go distribution:
+//
+//	node $(go env GOROOT)/lib/wasm/wasm_exec_node.js testdata/jsapi/main.wasm > testdata/jsapi/want.txt
+//
+// testdata/fs, testdata/links, testdata/fds and testdata/cwd work in a directory given as their argument,
+// which must not exist, on the host filesystem under Node.js and in a fresh
+// MemFS here.
+var conformancePrograms = []string{
+	"jsapi",
+	"arrays",
+	"typedarrays",
+	"fs",
+	"links",
+	"fds",
+	"cwd",
+}
+
+// runLogged runs the guest at path and returns what it logged with
+// console.log. The setup functions can prepare the instance before it runs.
+func runLogged(t *testing.T, path string, setup ...func(inst *Instance)) string {
+	t.Helper()
+	return runWith(t, Options{}, path, nil, setup...)
+}
+
+// runWith is like runLogged, but loads the guest with opts and runs it with
+// args. The setup functions run after console.log is in place.
+func runWith(t *testing.T, opts Options, path string, args []string, setup ...func(inst *Instance)) string {
+	t.Helper()
+
+	inst := loadWasm(t, NewRuntime(opts), path)
+
+	var out strings.Builder
+	inst.Global()["console"] = map[string]interface{}{
+		"log": func(line string) {
+			out.WriteString(line)
+			out.WriteString("\n")
+		},
+	}
+	for _, f := range setup {
+		f(inst)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := inst.Run(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.String()
+}
+
+func TestConformance(t *testing.T) {
+	for _, name := range conformancePrograms {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join("testdata", name)
+			want, err := ioutil.ReadFile(filepath.Join(dir, "want.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := runLogged(t, filepath.Join(dir, "main.wasm"))
+
+			gotLines := strings.Split(got, "\n")
+			wantLines := strings.Split(string(want), "\n")
+			for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+				var g, w string
+				if i < len(gotLines) {
+					g = gotLines[i]
+				}
+				if i < len(wantLines) {
+					w = wantLines[i]
+				}
+				if g != w {
+					t.Errorf("line %d:\ngot:  %q\nwant: %q", i+1, g, w)
+				}
+			}
+		})
+	}
+}
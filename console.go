@@ -0,0 +1,28 @@
+package wasmvm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// newConsole returns the console object of inst. log and info write to its
+// standard output, warn and error to its standard error.
+func newConsole(inst *Instance) map[string]interface{} {
+	printer := func(w io.Writer) func(args ...interface{}) {
+		return func(args ...interface{}) {
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				parts[i] = jsString(arg)
+			}
+			_, _ = fmt.Fprintln(w, strings.Join(parts, " "))
+		}
+	}
+
+	return map[string]interface{}{
+		"log":   printer(stdWriter{inst, 1}),
+		"info":  printer(stdWriter{inst, 1}),
+		"warn":  printer(stdWriter{inst, 2}),
+		"error": printer(stdWriter{inst, 2}),
+	}
+}
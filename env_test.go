@@ -0,0 +1,59 @@
+package wasmvm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/env/main.wasm ./testdata/env
+
+func TestEnv(t *testing.T) {
+	env := map[string]string{
+		"HOME": "/home/x",
+		"B":    "two words",
+		"A":    "",
+	}
+	got := runWith(t, Options{Env: env}, "testdata/env/main.wasm", []string{"env", "first", "sécond arg", ""})
+
+	want := `arg 0: "env"
+arg 1: "first"
+arg 2: "sécond arg"
+arg 3: ""
+env: "A="
+env: "B=two words"
+env: "HOME=/home/x"
+HOME: "/home/x" true
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestArgsLimit(t *testing.T) {
+	// "env" and the four pointers of argv take 40 bytes, and the end of the
+	// memory for them must stay below the 8 KiB, 8 bytes aligned.
+	longest := strings.Repeat("x", 8192-40-8-1)
+	got := runWith(t, Options{}, "testdata/env/main.wasm", []string{"env", longest})
+	if !strings.HasPrefix(got, `arg 0: "env"`) {
+		t.Errorf("got:\n%s", got)
+	}
+
+	for name, opts := range map[string]Options{
+		"args": {},
+		"env":  {Env: map[string]string{"LONG": longest}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			args := []string{"env"}
+			if opts.Env == nil {
+				args = append(args, longest+"x")
+			}
+
+			inst := loadWasm(t, NewRuntime(opts), "testdata/env/main.wasm")
+			err := inst.Run(context.Background(), args)
+			if want := "total length of command line and environment variables exceeds limit"; err == nil || err.Error() != want {
+				t.Errorf("got error %v, want %q", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package wasmvm
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Error is a JavaScript Error object. Host functions throw one into the guest
+// by returning it, or any other error, as their last result.
+type Error struct {
+	Message string
+	// Code is the Node.js error code, such as "ENOENT", if any.
+	Code string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return e.Code + ": " + e.Message
+	}
+	return e.Message
+}
+
+// jsError returns err as a JavaScript Error object.
+func jsError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{Message: err.Error()}
+}
+
+// errnoDesc is a system error of syscall/tables_js.go with its host value
+// and description.
+type errnoDesc struct {
+	errno   syscall.Errno
+	code    string
+	message string
+}
+
+// errnos are the system errors of syscall/tables_js.go that every host
+// has, in the order of that table, with the description Node.js gives them.
+// hostErrnos adds the ones only some hosts have. Where the host has two names
+// for one value, the first one wins. Codes missing here would crash the
+// guest, which panics on codes it does not know.
+var errnos = []errnoDesc{
+	{syscall.EPERM, "EPERM", "operation not permitted"},
+	{syscall.ENOENT, "ENOENT", "no such file or directory"},
+	{syscall.ESRCH, "ESRCH", "no such process"},
+	{syscall.EINTR, "EINTR", "interrupted system call"},
+	{syscall.EIO, "EIO", "i/o error"},
+	{syscall.ENXIO, "ENXIO", "no such device or address"},
+	{syscall.E2BIG, "E2BIG", "argument list too long"},
+	{syscall.ENOEXEC, "ENOEXEC", "exec format error"},
+	{syscall.EBADF, "EBADF", "bad file descriptor"},
+	{syscall.ECHILD, "ECHILD", "no child processes"},
+	{syscall.EAGAIN, "EAGAIN", "resource temporarily unavailable"},
+	{syscall.ENOMEM, "ENOMEM", "not enough memory"},
+	{syscall.EACCES, "EACCES", "permission denied"},
+	{syscall.EFAULT, "EFAULT", "bad address in system call argument"},
+	{syscall.EBUSY, "EBUSY", "resource busy or locked"},
+	{syscall.EEXIST, "EEXIST", "file already exists"},
+	{syscall.EXDEV, "EXDEV", "cross-device link not permitted"},
+	{syscall.ENODEV, "ENODEV", "no such device"},
+	{syscall.ENOTDIR, "ENOTDIR", "not a directory"},
+	{syscall.EISDIR, "EISDIR", "illegal operation on a directory"},
+	{syscall.EINVAL, "EINVAL", "invalid argument"},
+	{syscall.ENFILE, "ENFILE", "file table overflow"},
+	{syscall.EMFILE, "EMFILE", "too many open files"},
+	{syscall.ENOTTY, "ENOTTY", "inappropriate ioctl for device"},
+	{syscall.EFBIG, "EFBIG", "file too large"},
+	{syscall.ENOSPC, "ENOSPC", "no space left on device"},
+	{syscall.ESPIPE, "ESPIPE", "invalid seek"},
+	{syscall.EROFS, "EROFS", "read-only file system"},
+	{syscall.EMLINK, "EMLINK", "too many links"},
+	{syscall.EPIPE, "EPIPE", "broken pipe"},
+	{syscall.ENAMETOOLONG, "ENAMETOOLONG", "name too long"},
+	{syscall.ENOSYS, "ENOSYS", "function not implemented"},
+	{syscall.EDQUOT, "EDQUOT", "disk quota exceeded"},
+	{syscall.EDOM, "EDOM", "numerical argument out of domain"},
+	{syscall.ERANGE, "ERANGE", "result too large"},
+	{syscall.EDEADLK, "EDEADLK", "resource deadlock avoided"},
+	{syscall.ENOLCK, "ENOLCK", "no locks available"},
+	{syscall.ENOTEMPTY, "ENOTEMPTY", "directory not empty"},
+	{syscall.ELOOP, "ELOOP", "too many symbolic links encountered"},
+	{syscall.ENOMSG, "ENOMSG", "no message of desired type"},
+	{syscall.EIDRM, "EIDRM", "identifier removed"},
+	{syscall.EREMOTE, "EREMOTE", "object is remote"},
+	{syscall.EPROTO, "EPROTO", "protocol error"},
+	{syscall.EBADMSG, "EBADMSG", "bad message"},
+	{syscall.EOVERFLOW, "EOVERFLOW", "value too large for defined data type"},
+	{syscall.EILSEQ, "EILSEQ", "illegal byte sequence"},
+	{syscall.EUSERS, "EUSERS", "too many users"},
+	{syscall.ENOTSOCK, "ENOTSOCK", "socket operation on non-socket"},
+	{syscall.EDESTADDRREQ, "EDESTADDRREQ", "destination address required"},
+	{syscall.EMSGSIZE, "EMSGSIZE", "message too long"},
+	{syscall.EPROTOTYPE, "EPROTOTYPE", "protocol wrong type for socket"},
+	{syscall.ENOPROTOOPT, "ENOPROTOOPT", "protocol not available"},
+	{syscall.EPROTONOSUPPORT, "EPROTONOSUPPORT", "protocol not supported"},
+	{syscall.ESOCKTNOSUPPORT, "ESOCKTNOSUPPORT", "socket type not supported"},
+	{syscall.EOPNOTSUPP, "EOPNOTSUPP", "operation not supported on socket"},
+	{syscall.EPFNOSUPPORT, "EPFNOSUPPORT", "protocol family not supported"},
+	{syscall.EAFNOSUPPORT, "EAFNOSUPPORT", "address family not supported"},
+	{syscall.EADDRINUSE, "EADDRINUSE", "address already in use"},
+	{syscall.EADDRNOTAVAIL, "EADDRNOTAVAIL", "address not available"},
+	{syscall.ENETDOWN, "ENETDOWN", "network is down"},
+	{syscall.ENETUNREACH, "ENETUNREACH", "network is unreachable"},
+	{syscall.ENETRESET, "ENETRESET", "connection reset by network"},
+	{syscall.ECONNABORTED, "ECONNABORTED", "software caused connection abort"},
+	{syscall.ECONNRESET, "ECONNRESET", "connection reset by peer"},
+	{syscall.ENOBUFS, "ENOBUFS", "no buffer space available"},
+	{syscall.EISCONN, "EISCONN", "socket is already connected"},
+	{syscall.ENOTCONN, "ENOTCONN", "socket is not connected"},
+	{syscall.ESHUTDOWN, "ESHUTDOWN", "cannot send after transport endpoint shutdown"},
+	{syscall.ETOOMANYREFS, "ETOOMANYREFS", "too many references"},
+	{syscall.ETIMEDOUT, "ETIMEDOUT", "connection timed out"},
+	{syscall.ECONNREFUSED, "ECONNREFUSED", "connection refused"},
+	{syscall.EHOSTDOWN, "EHOSTDOWN", "host is down"},
+	{syscall.EHOSTUNREACH, "EHOSTUNREACH", "host is unreachable"},
+	{syscall.EALREADY, "EALREADY", "connection already in progress"},
+	{syscall.EINPROGRESS, "EINPROGRESS", "operation in progress"},
+	{syscall.ESTALE, "ESTALE", "stale file handle"},
+	{syscall.ENOTSUP, "ENOTSUP", "operation not supported"},
+	{syscall.ECANCELED, "ECANCELED", "operation canceled"},
+	{syscall.EWOULDBLOCK, "EWOULDBLOCK", "operation would block"},
+}
+
+var (
+	// errnoMessages maps the codes of errnos to their descriptions.
+	errnoMessages = map[string]string{}
+	// errnoCodes maps the host values of errnos to their codes.
+	errnoCodes = map[syscall.Errno]string{}
+)
+
+func init() {
+	for _, e := range append(errnos, hostErrnos...) {
+		errnoMessages[e.code] = e.message
+		if _, ok := errnoCodes[e.errno]; !ok {
+			errnoCodes[e.errno] = e.code
+		}
+	}
+}
+
+// errno returns a system error with the given Node.js code. FS
+// implementations return these to make the guest see the matching
+// syscall.Errno.
+func errno(code string) *Error {
+	return &Error{Message: errnoMessages[code], Code: code}
+}
+
+// fsError returns err as the system error passed to fs callbacks. Errors
+// without a code become EIO, as the guest cannot map them otherwise.
+func fsError(err error) *Error {
+	var (
+		e  *Error
+		en syscall.Errno
+	)
+	switch {
+	case errors.As(err, &e) && e.Code != "":
+		return e
+	case errors.As(err, &en) && errnoCodes[en] != "":
+		return errno(errnoCodes[en])
+	case errors.Is(err, os.ErrNotExist):
+		return errno("ENOENT")
+	case errors.Is(err, os.ErrExist):
+		return errno("EEXIST")
+	case errors.Is(err, os.ErrPermission):
+		return errno("EPERM")
+	case errors.Is(err, os.ErrClosed):
+		return errno("EBADF")
+	case errors.Is(err, os.ErrInvalid):
+		return errno("EINVAL")
+	}
+
+	return &Error{Message: err.Error(), Code: "EIO"}
+}
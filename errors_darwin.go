@@ -0,0 +1,16 @@
+package wasmvm
+
+import "syscall"
+
+// hostErrnos are the system errors of syscall/tables_js.go that macOS has
+// and not every host does, in the order of that table.
+var hostErrnos = []errnoDesc{
+	{syscall.ENOSTR, "ENOSTR", "device not a stream"},
+	{syscall.ENODATA, "ENODATA", "no data available"},
+	{syscall.ETIME, "ETIME", "timer expired"},
+	{syscall.ENOSR, "ENOSR", "out of streams resources"},
+	{syscall.ENOLINK, "ENOLINK", "link has been severed"},
+	{syscall.EMULTIHOP, "EMULTIHOP", "multihop attempted"},
+	{syscall.EFTYPE, "EFTYPE", "inappropriate file type or format"},
+	{syscall.EPROCLIM, "EPROCLIM", "too many processes"},
+}
@@ -0,0 +1,45 @@
+package wasmvm
+
+import "syscall"
+
+// hostErrnos are the system errors of syscall/tables_js.go that Linux has
+// and not every host does, in the order of that table.
+var hostErrnos = []errnoDesc{
+	{syscall.ECHRNG, "ECHRNG", "channel number out of range"},
+	{syscall.EL2NSYNC, "EL2NSYNC", "level 2 not synchronized"},
+	{syscall.EL3HLT, "EL3HLT", "level 3 halted"},
+	{syscall.EL3RST, "EL3RST", "level 3 reset"},
+	{syscall.ELNRNG, "ELNRNG", "link number out of range"},
+	{syscall.EUNATCH, "EUNATCH", "protocol driver not attached"},
+	{syscall.ENOCSI, "ENOCSI", "no CSI structure available"},
+	{syscall.EL2HLT, "EL2HLT", "level 2 halted"},
+	{syscall.EBADE, "EBADE", "invalid exchange"},
+	{syscall.EBADR, "EBADR", "invalid request descriptor"},
+	{syscall.EXFULL, "EXFULL", "exchange full"},
+	{syscall.ENOANO, "ENOANO", "no anode"},
+	{syscall.EBADRQC, "EBADRQC", "invalid request code"},
+	{syscall.EBADSLT, "EBADSLT", "invalid slot"},
+	{syscall.EDEADLOCK, "EDEADLOCK", "resource deadlock avoided"},
+	{syscall.EBFONT, "EBFONT", "bad font file format"},
+	{syscall.ENOSTR, "ENOSTR", "device not a stream"},
+	{syscall.ENODATA, "ENODATA", "no data available"},
+	{syscall.ETIME, "ETIME", "timer expired"},
+	{syscall.ENOSR, "ENOSR", "out of streams resources"},
+	{syscall.ENONET, "ENONET", "machine is not on the network"},
+	{syscall.ENOPKG, "ENOPKG", "package not installed"},
+	{syscall.ENOLINK, "ENOLINK", "link has been severed"},
+	{syscall.EADV, "EADV", "advertise error"},
+	{syscall.ESRMNT, "ESRMNT", "srmount error"},
+	{syscall.ECOMM, "ECOMM", "communication error on send"},
+	{syscall.EMULTIHOP, "EMULTIHOP", "multihop attempted"},
+	{syscall.EDOTDOT, "EDOTDOT", "RFS specific error"},
+	{syscall.ENOTUNIQ, "ENOTUNIQ", "name not unique on network"},
+	{syscall.EBADFD, "EBADFD", "file descriptor in bad state"},
+	{syscall.EREMCHG, "EREMCHG", "remote address changed"},
+	{syscall.ELIBACC, "ELIBACC", "can not access a needed shared library"},
+	{syscall.ELIBBAD, "ELIBBAD", "accessing a corrupted shared library"},
+	{syscall.ELIBSCN, "ELIBSCN", ".lib section in a.out corrupted"},
+	{syscall.ELIBMAX, "ELIBMAX", "attempting to link in too many shared libraries"},
+	{syscall.ELIBEXEC, "ELIBEXEC", "cannot exec a shared library directly"},
+	{syscall.ENOMEDIUM, "ENOMEDIUM", "no medium found"},
+}
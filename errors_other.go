@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package wasmvm
+
+// hostErrnos are the system errors only some hosts have; this host adds none.
+var hostErrnos []errnoDesc
@@ -0,0 +1,140 @@
+package wasmvm
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/errnos/main.wasm ./testdata/errnos
+
+func TestFSError(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		code string
+	}{
+		{errno("EROFS"), "EROFS"},
+		{&os.PathError{Op: "open", Path: "/x", Err: syscall.ENOENT}, "ENOENT"},
+		{&os.LinkError{Op: "rename", Old: "/a", New: "/b", Err: syscall.EXDEV}, "EXDEV"},
+		{os.NewSyscallError("write", syscall.ENOSPC), "ENOSPC"},
+		{syscall.EWOULDBLOCK, "EAGAIN"},
+		{fs.ErrNotExist, "ENOENT"},
+		{fs.ErrExist, "EEXIST"},
+		{fs.ErrPermission, "EPERM"},
+		{fs.ErrClosed, "EBADF"},
+		{fs.ErrInvalid, "EINVAL"},
+		{&Error{Message: "no code"}, "EIO"},
+		{errors.New("unknown"), "EIO"},
+	} {
+		if got := fsError(test.err); got.Code != test.code {
+			t.Errorf("fsError(%v) = %v, want code %s", test.err, got, test.code)
+		}
+	}
+}
+
+// failFS fails to stat the files named after a code with that code.
+type failFS struct {
+	*MemFS
+}
+
+func (f failFS) Stat(name string) (os.FileInfo, error) {
+	return nil, errno(name[1:])
+}
+
+// Every code the host can report must be one the guest knows, or it panics.
+func TestGuestErrnos(t *testing.T) {
+	var codes []interface{}
+	for _, e := range append(errnos, hostErrnos...) {
+		// Package os retries calls that fail with EINTR, forever here.
+		if e.code != "EINTR" {
+			codes = append(codes, e.code)
+		}
+	}
+
+	got := runLogged(t, "testdata/errnos/main.wasm", func(inst *Instance) {
+		inst.global["fs"] = newFSImport(inst, failFS{NewMemFS()})
+		inst.global["codes"] = codes
+	})
+
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != len(codes) {
+		t.Fatalf("got %d lines for %d codes:\n%s", len(lines), len(codes), got)
+	}
+	for _, want := range []string{
+		"ENOENT: 2 No such file or directory notexist=true exist=false permission=false",
+		"EEXIST: 17 File exists notexist=false exist=true permission=false",
+		"EACCES: 13 Permission denied notexist=false exist=false permission=true",
+		"EPERM: 1 Operation not permitted notexist=false exist=false permission=true",
+		"ENOTEMPTY: 39 Directory not empty notexist=false exist=true permission=false",
+		"EROFS: 30 Read-only file system notexist=false exist=false permission=false",
+		"EWOULDBLOCK: 11 Try again notexist=false exist=false permission=false",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "not an errno") {
+			t.Error(line)
+		}
+	}
+}
+
+// missingErrnos are the codes of syscall/tables_js.go each host has no errno
+// for.
+var missingErrnos = map[string]string{
+	"linux": "ELBIN EFTYPE ENMFILE EPROCLIM ENOSHARE ECASECLASH",
+	"darwin": "ECHRNG EL2NSYNC EL3HLT EL3RST ELNRNG EUNATCH ENOCSI EL2HLT " +
+		"EBADE EBADR EXFULL ENOANO EBADRQC EBADSLT EDEADLOCK EBFONT ENONET " +
+		"ENOPKG EADV ESRMNT ECOMM EDOTDOT ENOTUNIQ EBADFD EREMCHG ELIBACC " +
+		"ELIBBAD ELIBSCN ELIBMAX ELIBEXEC ENOMEDIUM ELBIN ENMFILE ENOSHARE " +
+		"ECASECLASH",
+}
+
+// Every code of the guest that the host has maps to a host errno.
+func TestErrnoTable(t *testing.T) {
+	missing, ok := missingErrnos[runtime.GOOS]
+	if !ok {
+		t.Skip("no list of missing errnos for", runtime.GOOS)
+	}
+	table, err := os.ReadFile(filepath.Join(runtime.GOROOT(), "src", "syscall", "tables_js.go"))
+	if err != nil {
+		t.Skip("cannot read the js errno table:", err)
+	}
+
+	start := strings.Index(string(table), "var errnoByCode")
+	if start < 0 {
+		t.Fatal("no errnoByCode in tables_js.go")
+	}
+	codes := regexp.MustCompile(`(?m)^\s+"(E[A-Z0-9]+)":`).FindAllStringSubmatch(string(table[start:]), -1)
+	if len(codes) == 0 {
+		t.Fatal("no codes in errnoByCode")
+	}
+
+	skip := map[string]bool{}
+	for _, code := range strings.Fields(missing) {
+		skip[code] = true
+	}
+	known := map[string]bool{}
+	for _, m := range codes {
+		known[m[1]] = true
+		if _, ok := errnoMessages[m[1]]; !ok && !skip[m[1]] {
+			t.Errorf("%s has no host errno", m[1])
+		}
+	}
+
+	for _, e := range append(errnos, hostErrnos...) {
+		if !known[e.code] {
+			t.Errorf("%s is not a code of the guest", e.code)
+		}
+		if got := fsError(e.errno).Code; !known[got] {
+			t.Errorf("errno %d maps to %s, which the guest does not know", e.errno, got)
+		}
+	}
+}
@@ -1,7 +1,11 @@
-package main
+package wasmvm
 
+// wasmEvent is the _pendingEvent object through which a guest function is
+// called. The guest reads id, this and args and stores its return value in
+// result.
 type wasmEvent struct {
 	Id     float64
+	This   interface{}
 	Args   []interface{}
-	Result []interface{}
+	Result interface{}
 }
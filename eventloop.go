@@ -0,0 +1,214 @@
+package wasmvm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// eventLoop queues the work that wasm_exec.js would leave to the JavaScript
+// event loop: tasks posted by the host and timeouts scheduled by the guest
+// runtime through scheduleTimeoutEvent.
+type eventLoop struct {
+	mu            sync.Mutex
+	tasks         []func() error
+	timeouts      map[int32]time.Time
+	nextTimeoutID int32
+	wake          chan struct{}
+	// pending counts the operations in progress on other goroutines, such
+	// as reads from stdin, that will post a task when done.
+	pending int
+}
+
+func newEventLoop() *eventLoop {
+	return &eventLoop{
+		timeouts:      map[int32]time.Time{},
+		nextTimeoutID: 1,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// post queues f to run on the instance goroutine once the guest yields. It
+// is safe to call from any goroutine.
+func (l *eventLoop) post(f func() error) {
+	l.mu.Lock()
+	l.tasks = append(l.tasks, f)
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// hold records an operation in progress, which ends by posting its task with
+// release. The loop waits for it instead of reporting a deadlock.
+func (l *eventLoop) hold() {
+	l.mu.Lock()
+	l.pending++
+	l.mu.Unlock()
+}
+
+// release ends an operation recorded by hold, queueing f like post.
+func (l *eventLoop) release(f func() error) {
+	l.mu.Lock()
+	l.pending--
+	l.tasks = append(l.tasks, f)
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// idle reports whether no task is queued and none is coming from an
+// operation in progress.
+func (l *eventLoop) idle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.tasks) == 0 && l.pending == 0
+}
+
+func (l *eventLoop) nextTask() func() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.tasks) == 0 {
+		return nil
+	}
+
+	f := l.tasks[0]
+	l.tasks[0] = nil
+	l.tasks = l.tasks[1:]
+
+	return f
+}
+
+// schedule adds a timeout firing at when.
+func (l *eventLoop) schedule(when time.Time) int32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := l.nextTimeoutID
+	l.nextTimeoutID++
+	l.timeouts[id] = when
+
+	return id
+}
+
+func (l *eventLoop) clear(id int32) {
+	l.mu.Lock()
+	delete(l.timeouts, id)
+	l.mu.Unlock()
+}
+
+func (l *eventLoop) scheduled(id int32) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.timeouts[id]
+	return ok
+}
+
+// nextTimeout returns the timeout that fires first.
+func (l *eventLoop) nextTimeout() (int32, time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var (
+		next  int32
+		when  time.Time
+		found bool
+	)
+	for id, t := range l.timeouts {
+		if !found || t.Before(when) || (t.Equal(when) && id < next) {
+			next, when, found = id, t, true
+		}
+	}
+
+	return next, when, found
+}
+
+// loop pumps events into the guest until it exits. When nothing is left that
+// could wake the guest up, neither timeouts nor operations in progress, it is
+// resumed with event id 0 so the Go runtime
+// reports the deadlock, like wasm_exec_node.js does on exit, unless the
+// runtime keeps idle guests alive.
+func (inst *Instance) loop(ctx context.Context) error {
+	l := inst.events
+
+	for !inst.exited() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if task := l.nextTask(); task != nil {
+			if err := task(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		id, when, ok := l.nextTimeout()
+		if !ok && !inst.rt.opts.KeepAlive && l.idle() {
+			inst.scope["_pendingEvent"] = &wasmEvent{Id: 0}
+			if err := inst.resume(); err != nil {
+				return err
+			}
+			return nil
+		}
+		if ok && l.idle() {
+			inst.clock.Idle(when)
+		}
+
+		if !ok || inst.clock.Now().Before(when) {
+			if !inst.wait(ctx, when, ok) {
+				continue
+			}
+		}
+
+		if err := inst.fireTimeout(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// wait blocks until the timeout due at when fires, if there is one, or until
+// a task is posted or ctx is done. It reports whether the timeout fired.
+func (inst *Instance) wait(ctx context.Context, when time.Time, timeout bool) bool {
+	var fire <-chan time.Time
+	if timeout {
+		c, stop := inst.clock.Timer(when)
+		defer stop()
+		fire = c
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-inst.events.wake:
+	case <-fire:
+		return true
+	}
+
+	return false
+}
+
+func (inst *Instance) fireTimeout(id int32) error {
+	if err := inst.resume(); err != nil {
+		return err
+	}
+
+	// The runtime clears the timeout it is woken up for. If it did not, it
+	// missed the event, so try again like wasm_exec.js does.
+	for !inst.exited() && inst.events.scheduled(id) {
+		if err := inst.resume(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package wasmvm
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/timers/main.wasm ./testdata/timers
+
+// The guest sleeps and waits on timers in order, never sees the timer it
+// stopped, and once nothing can wake it up anymore the runtime reports the
+// deadlock and exits with code 2, without waiting for the stopped timer.
+func TestTimers(t *testing.T) {
+	f, err := os.Open("testdata/timers/main.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	inst, err := NewRuntime(Options{}).Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var log []string
+	inst.global["console"] = map[string]interface{}{
+		"log": func(line string) { log = append(log, line) },
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err = inst.Run(ctx, nil)
+
+	want := []string{"start", "slept 10ms", "after 20ms", "stopped: true"}
+	if got := strings.Join(log, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("logged:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+	if exit, ok := err.(*ExitError); !ok || exit.Code != 2 {
+		t.Errorf("got error %v, want the deadlock exit status 2", err)
+	}
+}
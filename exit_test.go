@@ -0,0 +1,70 @@
+package wasmvm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/exit/main.wasm ./testdata/exit
+
+func TestExit(t *testing.T) {
+	for _, test := range []struct {
+		how    string
+		code   int
+		log    string
+		stdout string
+	}{
+		{"return", 0, "end of main\n", ""},
+		{"code", 3, "", "[1] partial line\n"},
+		{"callback", 4, "exiting in callback\n", ""},
+		{"panic", 2, "", ""},
+	} {
+		t.Run(test.how, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			opts := Options{Stdout: &stdout, Stderr: &stderr, OutputFormat: OutputPrefixed}
+			inst := loadWasm(t, NewRuntime(opts), "testdata/exit/main.wasm")
+
+			var log strings.Builder
+			inst.Global()["console"] = map[string]interface{}{
+				"log": func(line string) { log.WriteString(line + "\n") },
+			}
+			inst.Global()["call"] = func(f *Func) error {
+				_, err := f.Invoke()
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			err := inst.Run(ctx, []string{"exit", test.how})
+
+			var exit *ExitError
+			switch {
+			case test.code == 0 && err != nil:
+				t.Errorf("got error %v", err)
+			case test.code != 0 && (!errors.As(err, &exit) || exit.Code != test.code):
+				t.Errorf("got error %v, want exit status %d", err, test.code)
+			}
+			if got := inst.ExitCode(); got != test.code {
+				t.Errorf("got exit code %d, want %d", got, test.code)
+			}
+
+			if log.String() != test.log {
+				t.Errorf("logged:\n%s\nwant:\n%s", log.String(), test.log)
+			}
+			if stdout.String() != test.stdout {
+				t.Errorf("stdout: got %q, want %q", stdout.String(), test.stdout)
+			}
+			if test.how == "panic" && !strings.Contains(stderr.String(), "panic: boom") {
+				t.Errorf("stderr:\n%s", stderr.String())
+			}
+
+			if len(inst.refs.values) != refGo+1 {
+				t.Errorf("%d references left", len(inst.refs.values)-refGo-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package wasmvm
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMaxOpenFiles(t *testing.T) {
+	got := runWith(t, Options{MaxOpenFiles: 8}, "testdata/fds/main.wasm", []string{"fds", "/fdtest", "limit"})
+
+	want := "mkdir base: ok\n" +
+		"writefile: ok\n" +
+		"opened 5\n" +
+		"open over limit: Too many open files (errno 24)\n" +
+		"truncate over limit: Too many open files (errno 24)\n" +
+		"create over limit: Too many open files (errno 24)\n" +
+		"close one: ok\n" +
+		"contents: \"kept\" <nil>\n" +
+		"stat new: stat $BASE/new: No such file or directory (errno 2)\n" +
+		"open again: ok\n" +
+		"reused: true\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// openFS counts the files open in it.
+type openFS struct {
+	*MemFS
+	open *int
+}
+
+func (fs openFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := fs.MemFS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	*fs.open++
+	return countedFile{f, fs.open}, nil
+}
+
+type countedFile struct {
+	File
+	open *int
+}
+
+func (f countedFile) Close() error {
+	*f.open--
+	return f.File.Close()
+}
+
+// The files a guest leaves open are closed when it exits.
+func TestFilesClosedOnExit(t *testing.T) {
+	open := 0
+	runLogged(t, "testdata/fds/main.wasm", func(inst *Instance) {
+		inst.global["fs"] = newFSImport(inst, openFS{NewMemFS(), &open})
+	})
+
+	if open != 0 {
+		t.Errorf("%d files left open", open)
+	}
+}
@@ -1,90 +1,581 @@
-package main
+package wasmvm
 
 import (
-	"fmt"
 	"io"
 	"os"
-	"reflect"
-	"syscall"
+	"strings"
+	"time"
 )
 
-var constants = map[string]interface{}{
-	"O_WRONLY": -1,
-	"O_RDWR":   -1,
-	"O_CREAT":  -1,
-	"O_TRUNC":  -1,
-	"O_APPEND": -1,
-	"O_EXCL":   -1,
-}
-
-var fsImport = map[string]interface{}{
-	"write": func(fd float64, buf *uint8array, offset int, _length float64, position interface{}, callback interface{}) {
-		var w io.Writer
-		length := int(_length)
-		switch fd {
-		case float64(syscall.Stdout):
-			w = os.Stdout
-		case float64(syscall.Stderr):
-			w = os.Stderr
-		case float64(syscall.Stdin):
-			w = os.Stdin
-		default:
-			fmt.Printf("Invalid FD: %f\n", fd)
+// Flags of fs.constants, with the values Node.js has on Linux.
+const (
+	nodeRDONLY = 0
+	nodeWRONLY = 1
+	nodeRDWR   = 2
+	nodeCREAT  = 0100
+	nodeEXCL   = 0200
+	nodeTRUNC  = 01000
+	nodeAPPEND = 02000
+
+	nodeNOCTTY    = 0400
+	nodeNONBLOCK  = 04000
+	nodeDSYNC     = 010000
+	nodeDIRECTORY = 0200000
+	nodeNOFOLLOW  = 0400000
+	nodeSYNC      = 04010000
+)
+
+// fsModule is the fs object of an instance, the part of the Node.js fs module
+// syscall/fs_js.go uses, backed by an FS. Like in Node.js, every call reports
+// its result through a callback that runs after the guest yields.
+type fsModule struct {
+	inst  *Instance
+	fs    FS
+	files map[int]*openFile
+	// limit is the number of descriptors the guest may have open.
+	limit int
+}
+
+// openFile is a file descriptor of the guest.
+type openFile struct {
+	file File
+	flag int
+	// pos is where reads and writes without a position happen.
+	pos int64
+}
+
+// readable reports whether f was opened for reading.
+func (f *openFile) readable() bool {
+	return f.flag&os.O_WRONLY == 0
+}
+
+// at returns where a read or write at position happens: at position if it
+// is a number, or at the offset of f, which then advances, if it is null or
+// -1, like in Node.js.
+func (f *openFile) at(position interface{}) (pos int64, seek bool, err error) {
+	p, ok := position.(float64)
+	if !ok || p == -1 {
+		return f.pos, false, nil
+	}
+	if p < 0 || p != float64(int64(p)) {
+		return 0, false, errno("EINVAL")
+	}
+
+	return int64(p), true, nil
+}
+
+// defaultMaxOpenFiles is the usual limit of open files of Linux processes.
+const defaultMaxOpenFiles = 1024
+
+// newFSImport returns the fs module of inst, serving fs with the
+// permissions of the identity of inst.
+func newFSImport(inst *Instance, fs FS) map[string]interface{} {
+	m := &fsModule{
+		inst:  inst,
+		fs:    &permFS{fs: fs, id: &inst.identity},
+		limit: inst.rt.opts.MaxOpenFiles,
+		files: map[int]*openFile{
+			0: {file: &stdioFile{r: stdin(inst.rt.opts.Stdin)}},
+			1: {file: &stdioFile{w: stdWriter{inst, 1}}, flag: os.O_WRONLY},
+			2: {file: &stdioFile{w: stdWriter{inst, 2}}, flag: os.O_WRONLY},
+		},
+	}
+
+	if m.limit <= 0 {
+		m.limit = defaultMaxOpenFiles
+	}
+	inst.files = m
+
+	constants := map[string]interface{}{
+		"O_RDONLY": nodeRDONLY,
+		"O_WRONLY": nodeWRONLY,
+		"O_RDWR":   nodeRDWR,
+		"O_CREAT":  nodeCREAT,
+		"O_TRUNC":  nodeTRUNC,
+		"O_APPEND": nodeAPPEND,
+		"O_EXCL":   nodeEXCL,
+
+		"O_NOCTTY":    nodeNOCTTY,
+		"O_NONBLOCK":  nodeNONBLOCK,
+		"O_DSYNC":     nodeDSYNC,
+		"O_DIRECTORY": nodeDIRECTORY,
+		"O_NOFOLLOW":  nodeNOFOLLOW,
+		"O_SYNC":      nodeSYNC,
+
+		"S_IFMT":   modeIFMT,
+		"S_IFREG":  modeIFREG,
+		"S_IFDIR":  modeIFDIR,
+		"S_IFCHR":  modeIFCHR,
+		"S_IFBLK":  modeIFBLK,
+		"S_IFIFO":  modeIFIFO,
+		"S_IFLNK":  modeIFLNK,
+		"S_IFSOCK": modeIFSOCK,
+
+		"F_OK": 0,
+		"R_OK": 4,
+		"W_OK": 2,
+		"X_OK": 1,
+	}
+
+	return map[string]interface{}{
+		"open":      m.open,
+		"close":     m.close,
+		"read":      m.read,
+		"write":     m.write,
+		"fstat":     m.fstat,
+		"fsync":     m.fsync,
+		"ftruncate": m.ftruncate,
+		"fchmod":    m.fchmod,
+		"fchown":    m.fchown,
+		"stat":      m.stat,
+		"lstat":     m.lstat,
+		"readdir":   m.readdir,
+		"mkdir":     m.mkdir,
+		"rename":    m.rename,
+		"unlink":    m.unlink,
+		"rmdir":     m.rmdir,
+		"truncate":  m.truncate,
+		"chmod":     m.chmod,
+		"chown":     m.chown,
+		"lchown":    m.lchown,
+		"utimes":    m.utimes,
+		"link":      m.link,
+		"symlink":   m.symlink,
+		"readlink":  m.readlink,
+		"constants": constants,
+	}
+}
+
+// done calls back the guest with err, or with a null error followed by
+// result.
+func (m *fsModule) done(callback *Func, err error, result ...interface{}) {
+	if err != nil {
+		m.inst.callback(callback, fsError(err))
+		return
+	}
+
+	m.inst.callback(callback, append([]interface{}{nil}, result...)...)
+}
+
+// file returns the open file with descriptor fd.
+func (m *fsModule) file(fd float64) (*openFile, error) {
+	f, ok := m.files[int(fd)]
+	if !ok || fd != float64(int(fd)) {
+		return nil, errno("EBADF")
+	}
+
+	return f, nil
+}
+
+// openFlags converts flags of fs.constants to os.O_* flags. O_DIRECTORY and
+// O_NOFOLLOW are checked by open, and the flags with no meaning for an FS are
+// ignored.
+func openFlags(flags int) int {
+	var flag int
+	switch flags & (nodeWRONLY | nodeRDWR) {
+	case nodeWRONLY:
+		flag = os.O_WRONLY
+	case nodeRDWR:
+		flag = os.O_RDWR
+	default:
+		flag = os.O_RDONLY
+	}
+
+	for node, o := range map[int]int{
+		nodeCREAT:  os.O_CREATE,
+		nodeEXCL:   os.O_EXCL,
+		nodeTRUNC:  os.O_TRUNC,
+		nodeAPPEND: os.O_APPEND,
+		nodeDSYNC:  os.O_SYNC,
+	} {
+		if flags&node != 0 {
+			flag |= o
+		}
+	}
+
+	return flag
+}
+
+func (m *fsModule) open(path string, flags, mode float64, callback *Func) {
+	// The descriptor is taken first, so an open that fails for lack of one
+	// creates and truncates nothing.
+	fd := 0
+	for m.files[fd] != nil {
+		fd++
+	}
+	if fd >= m.limit {
+		m.done(callback, errno("EMFILE"))
+		return
+	}
+
+	name := m.inst.abs(path)
+	if int(flags)&nodeNOFOLLOW != 0 {
+		if fi, err := m.fs.Lstat(name); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			m.done(callback, errno("ELOOP"))
 			return
 		}
+	}
 
-		n, err := fmt.Fprintf(w, "WASM: %s", string(buf.data[offset:offset+length]))
+	flag := openFlags(int(flags))
+	file, err := m.fs.OpenFile(name, flag, fileMode(uint32(mode)))
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
 
-		if callback != nil {
-			if cbarr, ok := callback.([]interface{}); ok && len(cbarr) > 0 {
-				cb := cbarr[0]
-				t := reflect.TypeOf(cb)
-				v := reflect.ValueOf(cb)
-				inputLen := t.NumIn()
-				outputLen := t.NumOut()
+	if int(flags)&nodeDIRECTORY != 0 {
+		if fi, err := file.Stat(); err != nil || !fi.IsDir() {
+			file.Close()
+			if err == nil {
+				err = errno("ENOTDIR")
+			}
+			m.done(callback, err)
+			return
+		}
+	}
+
+	m.files[fd] = &openFile{file: file, flag: flag}
 
-				var verr reflect.Value
+	m.done(callback, nil, fd)
+}
 
-				if err == nil {
-					verr = reflect.ValueOf(false)
-				} else {
-					verr = reflect.ValueOf(err)
-				}
+// closeAll closes the files the guest left open.
+func (m *fsModule) closeAll() {
+	for fd, f := range m.files {
+		f.file.Close()
+		delete(m.files, fd)
+	}
+}
 
-				args := []reflect.Value{
-					verr,
-					reflect.ValueOf(n),
-				}
-				fmt.Printf("Callback: %+v %d %d\n", t, inputLen, outputLen)
+func (m *fsModule) close(fd float64, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
 
-				result := v.Call(args)
-				fmt.Printf("Result %+v\n", result)
+	delete(m.files, int(fd))
+	m.done(callback, f.file.Close())
+}
 
-			}
+// buffer returns the part of buf given by offset and length, or EINVAL if it
+// is out of range.
+func buffer(buf []byte, offset, length float64) ([]byte, error) {
+	if offset < 0 || length < 0 || offset+length > float64(len(buf)) {
+		return nil, errno("EINVAL")
+	}
+
+	return buf[int(offset):int(offset+length)], nil
+}
+
+// read reads into buf at the given position, or at the offset of fd when
+// position is null, which then advances.
+func (m *fsModule) read(fd float64, buf []byte, offset, length float64, position interface{}, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+	if !f.readable() {
+		m.done(callback, errno("EBADF"))
+		return
+	}
+	p, err := buffer(buf, offset, length)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	if s, ok := f.file.(*stdioFile); ok && s.r != nil {
+		m.readStream(s.r, p, callback)
+		return
+	}
+
+	pos, seek, err := f.at(position)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	n, err := f.file.ReadAt(p, pos)
+	if err == io.EOF {
+		err = nil
+	}
+	if !seek {
+		f.pos += int64(n)
+	}
+
+	m.done(callback, err, n)
+}
+
+// readStream reads from r on another goroutine, as it may block for long,
+// and calls back the guest once data arrives. Meanwhile the guest keeps
+// running its other goroutines and timers.
+func (m *fsModule) readStream(r io.Reader, p []byte, callback *Func) {
+	events := m.inst.events
+	events.hold()
+
+	go func() {
+		n, err := 0, error(nil)
+		for n == 0 && err == nil && len(p) > 0 {
+			n, err = r.Read(p)
+		}
+		if err == io.EOF {
+			err = nil
+		}
+
+		events.release(func() error {
+			m.done(callback, err, n)
+			return nil
+		})
+	}()
+}
+
+// write is like read. Writes to files opened for appending always go to
+// their end.
+func (m *fsModule) write(fd float64, buf []byte, offset, length float64, position interface{}, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+	if !writable(f.flag) {
+		m.done(callback, errno("EBADF"))
+		return
+	}
+	p, err := buffer(buf, offset, length)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	pos, seek, err := f.at(position)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+	if f.flag&os.O_APPEND != 0 {
+		fi, err := f.file.Stat()
+		if err != nil {
+			m.done(callback, err)
+			return
 		}
-	}, // (fd, buf, offset, length, position, callback) {},,
-	"chmod":     func() { fmt.Println("chmod") },     // (path, mode, callback) { callback(enosys()); },,
-	"chown":     func() { fmt.Println("chown") },     // (path, uid, gid, callback) { callback(enosys()); },,
-	"close":     func() { fmt.Println("close") },     // (fd, callback) { callback(enosys()); },,
-	"fchmod":    func() { fmt.Println("fchmod") },    // (fd, mode, callback) { callback(enosys()); },,
-	"fchown":    func() { fmt.Println("fchown") },    // (fd, uid, gid, callback) { callback(enosys()); },,
-	"fstat":     func() { fmt.Println("fstat") },     // (fd, callback) { callback(enosys()); },,
-	"fsync":     func() { fmt.Println("fsync") },     // (fd, callback) { callback(null); },,
-	"ftruncate": func() { fmt.Println("ftruncate") }, // (fd, length, callback) { callback(enosys()); },,
-	"lchown":    func() { fmt.Println("lchown") },    // (path, uid, gid, callback) { callback(enosys()); },,
-	"link":      func() { fmt.Println("link") },      // (path, link, callback) { callback(enosys()); },,
-	"lstat":     func() { fmt.Println("lstat") },     // (path, callback) { callback(enosys()); },,
-	"mkdir":     func() { fmt.Println("mkdir") },     // (path, perm, callback) { callback(enosys()); },,
-	"open":      func() { fmt.Println("open") },      // (path, flags, mode, callback) { callback(enosys()); },,
-	"read":      func() { fmt.Println("read") },      // (fd, buffer, offset, length, position, callback) { callback(enosys()); },,
-	"readdir":   func() { fmt.Println("readdir") },   // (path, callback) { callback(enosys()); },,
-	"readlink":  func() { fmt.Println("readlink") },  // (path, callback) { callback(enosys()); },,
-	"rename":    func() { fmt.Println("rename") },    // (from, to, callback) { callback(enosys()); },,
-	"rmdir":     func() { fmt.Println("rmdir") },     // (path, callback) { callback(enosys()); },,
-	"stat":      func() { fmt.Println("stat") },      // (path, callback) { callback(enosys()); },,
-	"symlink":   func() { fmt.Println("symlink") },   // (path, link, callback) { callback(enosys()); },,
-	"truncate":  func() { fmt.Println("truncate") },  // (path, length, callback) { callback(enosys()); },,
-	"unlink":    func() { fmt.Println("unlink") },    // (path, callback) { callback(enosys()); },,
-	"utimes":    func() { fmt.Println("utimes") },    // (path, atime, mtime, callback) { callback(enosys()); },,
-	"constants": constants,
+		pos = fi.Size()
+	}
+
+	n, err := f.file.WriteAt(p, pos)
+	if !seek {
+		f.pos = pos + int64(n)
+	}
+
+	m.done(callback, err, n)
+}
+
+func (m *fsModule) fstat(fd float64, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	fi, err := f.file.Stat()
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, nil, newStats(fi))
 }
+
+func (m *fsModule) fsync(fd float64, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, f.file.Sync())
+}
+
+// ftruncate truncates fd, which must be open for writing, to length. Like
+// in Node.js, negative lengths truncate to 0.
+func (m *fsModule) ftruncate(fd, length float64, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+	if !writable(f.flag) {
+		m.done(callback, errno("EINVAL"))
+		return
+	}
+
+	m.done(callback, f.file.Truncate(truncateLength(length)))
+}
+
+// truncateLength returns the length to truncate files to for length.
+func truncateLength(length float64) int64 {
+	if length < 0 {
+		return 0
+	}
+	return int64(length)
+}
+
+func (m *fsModule) fchmod(fd, mode float64, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, f.file.Chmod(fileMode(uint32(mode))))
+}
+
+func (m *fsModule) fchown(fd, uid, gid float64, callback *Func) {
+	f, err := m.file(fd)
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, f.file.Chown(ownerID(uid), ownerID(gid)))
+}
+
+func (m *fsModule) stat(path string, callback *Func) {
+	fi, err := m.fs.Stat(m.inst.abs(path))
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, nil, newStats(fi))
+}
+
+func (m *fsModule) lstat(path string, callback *Func) {
+	fi, err := m.fs.Lstat(m.inst.abs(path))
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, nil, newStats(fi))
+}
+
+func (m *fsModule) readdir(path string, callback *Func) {
+	names, err := m.fs.ReadDir(m.inst.abs(path))
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, nil, names)
+}
+
+func (m *fsModule) mkdir(path string, perm float64, callback *Func) {
+	m.done(callback, m.fs.Mkdir(m.inst.abs(path), fileMode(uint32(perm))))
+}
+
+func (m *fsModule) rename(from, to string, callback *Func) {
+	m.done(callback, m.fs.Rename(m.inst.abs(from), m.inst.abs(to)))
+}
+
+func (m *fsModule) unlink(path string, callback *Func) {
+	m.done(callback, m.fs.Unlink(m.inst.abs(path)))
+}
+
+func (m *fsModule) rmdir(path string, callback *Func) {
+	m.done(callback, m.fs.Rmdir(m.inst.abs(path)))
+}
+
+func (m *fsModule) truncate(path string, length float64, callback *Func) {
+	m.done(callback, m.fs.Truncate(m.inst.abs(path), truncateLength(length)))
+}
+
+func (m *fsModule) chmod(path string, mode float64, callback *Func) {
+	m.done(callback, m.fs.Chmod(m.inst.abs(path), fileMode(uint32(mode))))
+}
+
+// ownerID converts a user or group ID of chown, fchown or lchown. They get
+// unsigned numbers, so -1, which keeps the current value, arrives as
+// 0xffffffff.
+func ownerID(id float64) int {
+	return int(int32(uint32(id)))
+}
+
+func (m *fsModule) chown(path string, uid, gid float64, callback *Func) {
+	m.done(callback, m.fs.Chown(m.inst.abs(path), ownerID(uid), ownerID(gid)))
+}
+
+func (m *fsModule) lchown(path string, uid, gid float64, callback *Func) {
+	m.done(callback, m.fs.Lchown(m.inst.abs(path), ownerID(uid), ownerID(gid)))
+}
+
+// utimes gets times in seconds since the Unix epoch.
+func (m *fsModule) utimes(path string, atime, mtime float64, callback *Func) {
+	m.done(callback, m.fs.Chtimes(m.inst.abs(path), unixTime(atime), unixTime(mtime)))
+}
+
+func unixTime(sec float64) time.Time {
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+// link and symlink get the existing path first. The target of a symbolic
+// link is kept as given, as it may be relative to the link.
+func (m *fsModule) link(path, link string, callback *Func) {
+	m.done(callback, m.fs.Link(m.inst.abs(path), m.inst.abs(link)))
+}
+
+func (m *fsModule) symlink(target, link string, callback *Func) {
+	m.done(callback, m.fs.Symlink(target, m.inst.abs(link)))
+}
+
+func (m *fsModule) readlink(path string, callback *Func) {
+	target, err := m.fs.Readlink(m.inst.abs(path))
+	if err != nil {
+		m.done(callback, err)
+		return
+	}
+
+	m.done(callback, nil, target)
+}
+
+// stdin returns r, or an empty reader if r is nil.
+func stdin(r io.Reader) io.Reader {
+	if r == nil {
+		return strings.NewReader("")
+	}
+	return r
+}
+
+// stdioFile is a standard stream of the guest. It has no offsets, so reads
+// and writes ignore them.
+type stdioFile struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (f *stdioFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.r == nil {
+		return 0, errno("EBADF")
+	}
+
+	return f.r.Read(p)
+}
+
+func (f *stdioFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.w == nil {
+		return 0, errno("EBADF")
+	}
+
+	return f.w.Write(p)
+}
+
+func (f *stdioFile) Stat() (os.FileInfo, error) {
+	return &fileInfo{mode: os.ModeDevice | os.ModeCharDevice | 0620}, nil
+}
+
+func (f *stdioFile) Truncate(size int64) error    { return errno("EINVAL") }
+func (f *stdioFile) Sync() error                  { return errno("EINVAL") }
+func (f *stdioFile) Chmod(mode os.FileMode) error { return nil }
+func (f *stdioFile) Chown(uid, gid int) error     { return nil }
+func (f *stdioFile) Close() error                 { return nil }
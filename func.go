@@ -0,0 +1,300 @@
+package wasmvm
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/go-interpreter/wagon/exec"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Func is a function created by the guest with js.FuncOf. Host code can call
+// it from a host function the guest called, or from a task passed to
+// Instance.Post, but not concurrently with the guest.
+type Func struct {
+	inst *Instance
+	id   float64
+}
+
+// makeFuncWrapper is _makeFuncWrapper from wasm_exec.js.
+func (inst *Instance) makeFuncWrapper(id float64) *Func {
+	return &Func{inst: inst, id: id}
+}
+
+// Invoke calls f with this set to undefined and returns its result.
+func (f *Func) Invoke(args ...interface{}) (interface{}, error) {
+	return f.Call(nil, args...)
+}
+
+// Call calls f with the given this and arguments. The call is delivered to
+// the guest through _pendingEvent, and the value the guest stores back as the
+// event result is returned.
+func (f *Func) Call(this interface{}, args ...interface{}) (interface{}, error) {
+	event := &wasmEvent{Id: f.id, This: this, Args: args}
+	f.inst.scope["_pendingEvent"] = event
+
+	if err := f.inst.resume(); err != nil {
+		return nil, err
+	}
+
+	return event.Result, nil
+}
+
+// callback calls f with args once the current guest call returns, like
+// Node.js does with the callbacks of its asynchronous APIs. Nothing happens
+// if f is nil.
+func (inst *Instance) callback(f *Func, args ...interface{}) {
+	if f == nil {
+		return
+	}
+
+	inst.events.post(func() error {
+		_, err := f.Invoke(args...)
+		return err
+	})
+}
+
+// adapt returns f as a Go function of type t, so it can be passed to host
+// functions that take typed callbacks. A failed call makes the function
+// return the error if its last result is an error, and panic otherwise.
+func (f *Func) adapt(t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		if t.IsVariadic() {
+			last := in[len(in)-1]
+			in = in[:len(in)-1]
+			for i := 0; i < last.Len(); i++ {
+				in = append(in, last.Index(i))
+			}
+		}
+
+		res, err := f.Invoke(reflectValuesToInterface(in)...)
+
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+
+		values := out
+		if n := len(out); n > 0 && t.Out(n-1) == errorType {
+			values = out[:n-1]
+			if err != nil {
+				out[n-1] = reflect.ValueOf(&err).Elem()
+				return out
+			}
+		} else if err != nil {
+			panic(err)
+		}
+
+		if len(values) > 0 {
+			v, err := convertValue(res, t.Out(0))
+			if err != nil {
+				panic(err)
+			}
+			values[0] = v
+		}
+
+		return out
+	})
+}
+
+// callFunc calls fn, a host function or a *Func, with this and arguments
+// coming from the guest. Arguments are converted to the parameter types of fn;
+// missing ones are undefined. Host functions do not get this. The result is undefined when fn returns nothing and the
+// value itself when it returns one value. A trailing error result that is not
+// nil, or a panic, is returned as the exception to throw into the guest.
+func callFunc(fn interface{}, this interface{}, args []interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = &Error{Message: fmt.Sprint(r)}
+			}
+		}
+	}()
+
+	switch f := fn.(type) {
+	case *Func:
+		return f.Call(this, args...)
+	case *Class:
+		return nil, &Error{Message: fmt.Sprintf("Class constructor %s cannot be invoked without 'new'", f.Name)}
+	}
+
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return nil, &Error{Message: fmt.Sprintf("%T is not a function", fn)}
+	}
+	ft := fv.Type()
+
+	fixed := ft.NumIn()
+	if ft.IsVariadic() {
+		fixed--
+	}
+	count := fixed
+	if ft.IsVariadic() && len(args) > fixed {
+		count = len(args)
+	}
+
+	in := make([]reflect.Value, count)
+	for i := range in {
+		var t reflect.Type
+		if i < fixed {
+			t = ft.In(i)
+		} else {
+			t = ft.In(fixed).Elem()
+		}
+
+		var arg interface{} = Undefined
+		if i < len(args) {
+			arg = args[i]
+		}
+
+		v, err := convertValue(arg, t)
+		if err != nil {
+			return nil, err
+		}
+		in[i] = v
+	}
+
+	out := fv.Call(in)
+
+	if n := len(out); n > 0 && ft.Out(n-1) == errorType {
+		if e := out[n-1].Interface(); e != nil {
+			return nil, e.(error)
+		}
+		out = out[:n-1]
+	}
+
+	switch len(out) {
+	case 0:
+		return Undefined, nil
+	case 1:
+		return out[0].Interface(), nil
+	}
+
+	return reflectValuesToInterface(out), nil
+}
+
+// convertValue converts a value coming from the guest to type t. Numbers
+// convert to any numeric type, arrays to any slice type and guest functions
+// to any function type.
+func convertValue(v interface{}, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		return rv, nil
+	}
+
+	if v == Undefined {
+		return reflect.Zero(t), nil
+	}
+
+	// Arrays created by the guest are pointers to slices.
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Type().AssignableTo(t) {
+		return rv.Elem(), nil
+	}
+
+	// Byte buffers share their storage with the guest.
+	if t == reflect.TypeOf([]byte(nil)) {
+		switch b := v.(type) {
+		case *TypedArray:
+			if b.isBytes() {
+				return reflect.ValueOf(b.Bytes()), nil
+			}
+		case *ArrayBuffer:
+			return reflect.ValueOf(b.Bytes()), nil
+		}
+	}
+
+	// Other arrays are converted element by element.
+	if a, ok := arrayOf(v); ok && t.Kind() == reflect.Slice {
+		out := reflect.MakeSlice(t, a.Len(), a.Len())
+		for i := 0; i < a.Len(); i++ {
+			e, err := convertValue(a.Index(i).Interface(), t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Index(i).Set(e)
+		}
+		return out, nil
+	}
+
+	if f, ok := v.(*Func); ok && t.Kind() == reflect.Func {
+		return f.adapt(t), nil
+	}
+
+	if isNumberKind(rv.Kind()) && isNumberKind(t.Kind()) {
+		return rv.Convert(t), nil
+	}
+
+	return reflect.Value{}, &Error{Message: fmt.Sprintf("cannot use %T as %s", v, t)}
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// execExport runs the exported function name. Host functions may call back
+// into the guest, but wagon keeps a single execution context per VM, so a
+// nested call saves the context of the caller and restores it afterwards.
+func (inst *Instance) execExport(name string, args ...uint64) (interface{}, error) {
+	fn, ok := inst.module.Export.Entries[name]
+	if !ok {
+		return nil, fmt.Errorf("cannot find %s function", name)
+	}
+
+	if inst.depth > 0 {
+		ctx := vmContext(inst.vm)
+		saved := reflect.New(ctx.Type()).Elem()
+		saved.Set(ctx)
+		// A zero context makes ExecCode allocate a new operand stack
+		// instead of truncating the one the caller is still using.
+		ctx.Set(reflect.Zero(ctx.Type()))
+		defer ctx.Set(saved)
+	}
+
+	inst.depth++
+	inst.calls++
+	defer func() { inst.depth-- }()
+
+	res, err := inst.vm.ExecCode(int64(fn.Index), args...)
+	if inst.exited() {
+		// wasmExit stopped the VM; what it left on its stack is meaningless.
+		return nil, nil
+	}
+	return res, err
+}
+
+// vmContext returns the unexported execution context of vm.
+func vmContext(vm *exec.VM) reflect.Value {
+	field := reflect.ValueOf(vm).Elem().FieldByName("ctx")
+	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+}
+
+// stackPointer returns the guest stack pointer after a host call that started
+// when the guest had made the given number of calls. If the guest ran in the
+// meantime its stack may have moved, so sp is read again through getsp.
+func (inst *Instance) stackPointer(sp int32, calls uint64) int32 {
+	if inst.calls == calls || inst.exited() {
+		return sp
+	}
+
+	res, err := inst.execExport("getsp")
+	if err != nil {
+		panic(err)
+	}
+
+	return int32(res.(uint32))
+}
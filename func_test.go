@@ -0,0 +1,106 @@
+package wasmvm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/callbacks/main.wasm ./testdata/callbacks
+
+func TestCallbacks(t *testing.T) {
+	rt := NewRuntime(Options{KeepAlive: true})
+	inst := loadWasm(t, rt, "testdata/callbacks/main.wasm")
+
+	reports := map[string]interface{}{}
+	inst.Global()["report"] = func(name string, value interface{}) {
+		reports[name] = value
+	}
+	inst.Global()["apply"] = func(f *Func, x float64) (interface{}, error) {
+		return f.Invoke(x)
+	}
+
+	// Call the functions the guest leaves in the global object once it
+	// waits for them.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		inst.Post(func() error {
+			square, ok := inst.Global()["square"].(*Func)
+			if !ok {
+				return errors.New("square is not a guest function")
+			}
+			v, err := square.Invoke(7)
+			if err != nil {
+				return err
+			}
+			reports["square"] = v
+
+			_, err = inst.Global()["done"].(*Func).Invoke()
+			return err
+		})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := inst.Run(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"double": 42.0,
+		"sum":    55.0,
+		"square": 49.0,
+		"done":   true,
+	}
+	for name, v := range want {
+		if reports[name] != v {
+			t.Errorf("%s = %v, want %v", name, reports[name], v)
+		}
+	}
+}
+
+func TestCallFuncConvertsArguments(t *testing.T) {
+	add := func(a int, b uint8, rest ...float32) int {
+		sum := a + int(b)
+		for _, v := range rest {
+			sum += int(v)
+		}
+		return sum
+	}
+
+	res, err := callFunc(add, nil, []interface{}{1.0, 2.0, 3.0, 4.0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != 10 {
+		t.Errorf("add returned %v, want 10", res)
+	}
+
+	if res, err := callFunc(func() {}, nil, nil); res != Undefined || err != nil {
+		t.Errorf("func() returned %v, %v, want undefined", res, err)
+	}
+
+	if _, err := callFunc(add, nil, []interface{}{"1"}); err == nil {
+		t.Error("string converted to int")
+	}
+}
+
+func TestCallFuncThrowsErrors(t *testing.T) {
+	fail := func() (int, error) {
+		return 0, &Error{Message: "no such file", Code: "ENOENT"}
+	}
+	_, err := callFunc(fail, nil, nil)
+	if e, ok := err.(*Error); !ok || e.Code != "ENOENT" {
+		t.Errorf("got error %v, want ENOENT", err)
+	}
+
+	_, err = callFunc(func() { panic("boom") }, nil, nil)
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("got error %v, want boom", err)
+	}
+
+	if _, err := callFunc(42.0, nil, nil); err == nil {
+		t.Error("calling a number succeeded")
+	}
+}
@@ -1,9 +1,8 @@
 module github.com/racerxdl/wasmvm
 
-go 1.14
+go 1.16
 
 require (
 	github.com/go-interpreter/wagon v0.6.0
-	github.com/google/uuid v1.1.1
-	golang.org/x/crypto v0.0.0-20200406173513-056763e48d71
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
 )
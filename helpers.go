@@ -1,11 +1,10 @@
-package main
+package wasmvm
 
 import (
 	"encoding/binary"
 	"github.com/go-interpreter/wagon/exec"
 	"math"
 	"reflect"
-	"strings"
 )
 
 func getUInt64(proc *exec.Process, addr int32) uint64 {
@@ -66,12 +65,3 @@ func reflectValuesToInterface(vals []reflect.Value) []interface{} {
 
 	return islice
 }
-
-func switchPublicPrivate(name string) string {
-	newName := strings.ToLower(name[0:1]) + name[1:]
-	if newName == name {
-		return strings.ToUpper(name[0:1]) + name[1:]
-	}
-
-	return newName
-}
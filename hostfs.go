@@ -0,0 +1,448 @@
+package wasmvm
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSymlinks is how many symbolic links are followed to resolve a name
+// before giving up with ELOOP, like Linux does.
+const maxSymlinks = 40
+
+// HostFS is an FS backed by a directory of the host. The guest cannot reach
+// anything outside of it: names are resolved inside the directory, which
+// acts as their root, and symbolic links leading out of it fail with EACCES.
+// Links with an absolute target are followed when the target lies inside the
+// directory; the guest makes them with the host path of the target.
+//
+// Confinement is checked before each operation, so a host process changing
+// the directory concurrently may defeat it.
+type HostFS struct {
+	root     string
+	readOnly bool
+}
+
+// NewHostFS returns a HostFS for the host directory root. A read-only HostFS
+// fails every change with EROFS.
+func NewHostFS(root string, readOnly bool) (*HostFS, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{Op: "mount", Path: root, Err: errno("ENOTDIR")}
+	}
+
+	return &HostFS{root: root, readOnly: readOnly}, nil
+}
+
+// resolve returns the host path of name. Symbolic links are followed, except
+// for the last element of name when follow is false.
+func (fs *HostFS) resolve(name string, follow bool) (string, error) {
+	rest := strings.Split(name, "/")
+	var dir []string
+	links := 0
+
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			// Guest names are clean, so only link targets get here.
+			if len(dir) == 0 {
+				return "", errno("EACCES")
+			}
+			dir = dir[:len(dir)-1]
+			continue
+		}
+
+		host := fs.hostPath(append(dir, elem))
+		if len(rest) == 0 && !follow {
+			dir = append(dir, elem)
+			break
+		}
+
+		fi, err := os.Lstat(host)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			// Missing files are left for the operation to report.
+			dir = append(dir, elem)
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", errno("ELOOP")
+		}
+		target, err := os.Readlink(host)
+		if err != nil {
+			return "", err
+		}
+
+		if filepath.IsAbs(target) {
+			rel, err := filepath.Rel(fs.root, target)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return "", errno("EACCES")
+			}
+			dir, target = nil, rel
+		}
+		rest = append(strings.Split(filepath.ToSlash(target), "/"), rest...)
+	}
+
+	return fs.hostPath(dir), nil
+}
+
+func (fs *HostFS) hostPath(elems []string) string {
+	return filepath.Join(fs.root, filepath.FromSlash(path.Join(elems...)))
+}
+
+// write returns an error if fs is read-only.
+func (fs *HostFS) write() error {
+	if fs.readOnly {
+		return errno("EROFS")
+	}
+	return nil
+}
+
+// OpenFile implements FS.
+func (fs *HostFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if writable(flag) || flag&(os.O_CREATE|os.O_TRUNC) != 0 {
+		if err := fs.write(); err != nil {
+			return nil, err
+		}
+	}
+
+	host, err := fs.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// The guest file descriptor handles appending, and os.File does not
+	// allow WriteAt on files opened with O_APPEND.
+	f, err := os.OpenFile(host, flag&^os.O_APPEND, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hostFile{File: f, readOnly: fs.readOnly}, nil
+}
+
+// Stat implements FS.
+func (fs *HostFS) Stat(name string) (os.FileInfo, error) {
+	host, err := fs.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return hostFileInfo(fi), nil
+}
+
+// Lstat implements FS.
+func (fs *HostFS) Lstat(name string) (os.FileInfo, error) {
+	host, err := fs.resolve(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Lstat(host)
+	if err != nil {
+		return nil, err
+	}
+
+	return hostFileInfo(fi), nil
+}
+
+// ReadDir implements FS.
+func (fs *HostFS) ReadDir(name string) ([]string, error) {
+	host, err := fs.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(host)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Mkdir implements FS.
+func (fs *HostFS) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(name, false)
+	if err != nil {
+		return err
+	}
+
+	return os.Mkdir(host, perm)
+}
+
+// Unlink implements FS.
+func (fs *HostFS) Unlink(name string) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(name, false)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Lstat(host)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errno("EISDIR")
+	}
+
+	return os.Remove(host)
+}
+
+// Rmdir implements FS.
+func (fs *HostFS) Rmdir(name string) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+	if name == "/" {
+		return errno("EBUSY")
+	}
+
+	host, err := fs.resolve(name, false)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Lstat(host)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errno("ENOTDIR")
+	}
+
+	return os.Remove(host)
+}
+
+// Rename implements FS.
+func (fs *HostFS) Rename(oldname, newname string) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+	if oldname == "/" || newname == "/" {
+		return errno("EBUSY")
+	}
+
+	oldhost, err := fs.resolve(oldname, false)
+	if err != nil {
+		return err
+	}
+	newhost, err := fs.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(oldhost, newhost)
+}
+
+// Truncate implements FS.
+func (fs *HostFS) Truncate(name string, size int64) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(name, true)
+	if err != nil {
+		return err
+	}
+
+	return os.Truncate(host, size)
+}
+
+// Chmod implements FS.
+func (fs *HostFS) Chmod(name string, mode os.FileMode) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(name, true)
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(host, mode)
+}
+
+// Chown implements FS.
+func (fs *HostFS) Chown(name string, uid, gid int) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(name, true)
+	if err != nil {
+		return err
+	}
+
+	return os.Chown(host, uid, gid)
+}
+
+// Lchown implements FS.
+func (fs *HostFS) Lchown(name string, uid, gid int) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(name, false)
+	if err != nil {
+		return err
+	}
+
+	return os.Lchown(host, uid, gid)
+}
+
+// Chtimes implements FS.
+func (fs *HostFS) Chtimes(name string, atime, mtime time.Time) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(name, true)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(host, atime, mtime)
+}
+
+// Link implements FS.
+func (fs *HostFS) Link(oldname, newname string) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	oldhost, err := fs.resolve(oldname, false)
+	if err != nil {
+		return err
+	}
+	newhost, err := fs.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+
+	return os.Link(oldhost, newhost)
+}
+
+// Symlink implements FS. An absolute target is taken from the directory, and
+// stored as the host path it names there, so the link works on the host too.
+// Other targets are stored as given and checked when the link is followed.
+func (fs *HostFS) Symlink(oldname, newname string) error {
+	if err := fs.write(); err != nil {
+		return err
+	}
+
+	host, err := fs.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+
+	target := filepath.FromSlash(oldname)
+	if path.IsAbs(oldname) {
+		target = fs.hostPath([]string{oldname})
+	}
+
+	return os.Symlink(target, host)
+}
+
+// Readlink implements FS. An absolute target is returned as a name of the
+// directory. Reading a link leading out of the directory fails with EACCES,
+// as following it does.
+func (fs *HostFS) Readlink(name string) (string, error) {
+	host, err := fs.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := os.Readlink(host)
+	if err != nil {
+		return "", err
+	}
+
+	if filepath.IsAbs(target) {
+		rel, err := filepath.Rel(fs.root, target)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", errno("EACCES")
+		}
+		return cleanPath(filepath.ToSlash(rel)), nil
+	}
+
+	// The directories of name may be links themselves.
+	rel, err := filepath.Rel(fs.root, filepath.Dir(host))
+	if err != nil {
+		return "", err
+	}
+	target = filepath.ToSlash(target)
+	if up := path.Join(filepath.ToSlash(rel), target); up == ".." || strings.HasPrefix(up, "../") {
+		return "", errno("EACCES")
+	}
+
+	return target, nil
+}
+
+// hostFile is a File of a HostFS.
+type hostFile struct {
+	*os.File
+	readOnly bool
+}
+
+func (f *hostFile) Chmod(mode os.FileMode) error {
+	if f.readOnly {
+		return errno("EROFS")
+	}
+	return f.File.Chmod(mode)
+}
+
+func (f *hostFile) Chown(uid, gid int) error {
+	if f.readOnly {
+		return errno("EROFS")
+	}
+	return f.File.Chown(uid, gid)
+}
+
+func (f *hostFile) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return hostFileInfo(fi), nil
+}
@@ -0,0 +1,217 @@
+package wasmvm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/hostfs/main.wasm ./testdata/hostfs
+
+// hostTree creates the host files testdata/hostfs works with in a temporary
+// directory, and returns its path.
+func hostTree(t *testing.T) string {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "wasmvm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"secret.txt":         "secret\n",
+		"data/hello.txt":     "hello from the host\n",
+		"data/sub/inner.txt": "inner\n",
+		"ro/readme":          "read only\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"data/inside": filepath.Join(root, "data", "sub"),
+		"data/rel":    "sub/inner.txt",
+		"data/escape": filepath.Join(root, "secret.txt"),
+		"data/up":     "..",
+		"data/loop":   "loop",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skip("cannot create symbolic links:", err)
+		}
+	}
+
+	return root
+}
+
+func TestHostFS(t *testing.T) {
+	root := hostTree(t)
+
+	data, err := NewHostFS(filepath.Join(root, "data"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ro, err := NewHostFS(filepath.Join(root, "ro"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewMountFS(NewMemFS())
+	if err := fs.Mount("/data", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mount("/ro", ro); err != nil {
+		t.Fatal(err)
+	}
+
+	got := runLogged(t, "testdata/hostfs/main.wasm", func(inst *Instance) {
+		inst.global["fs"] = newFSImport(inst, fs)
+	})
+
+	want := `read /data/hello.txt: "hello from the host\n"
+read /data/inside/inner.txt: "inner\n"
+read /data/rel: "inner\n"
+read /data/../secret.txt: No such file or directory
+read /data/sub/../../../secret.txt: No such file or directory
+read /data/escape: Permission denied
+read /data/up: Permission denied
+read /data/up/secret.txt: Permission denied
+read /data/loop: Too many symbolic links
+stat escape: Permission denied
+lstat escape: ok
+escape is a link: true
+symlink out: ok
+read /data/mine: Permission denied
+write: ok
+read /data/new.txt: "written by the guest\n"
+read /ro/readme: "read only\n"
+write read-only: Read-only file system
+remove read-only: Read-only file system
+mkdir read-only: Read-only file system
+rename across mounts: Cross-device link
+remove mount point: Device or resource busy
+readdir /: ok
+entries: data ro
+symlink into mount: ok
+read /hello: "hello from the host\n"
+symlink to mount: ok
+read /datalink/sub/inner.txt: "inner\n"
+symlink relative: ok
+read /readme: "read only\n"
+symlink absolute: ok
+read /data/abs: "hello from the host\n"
+readlink /data/abs: ok
+target: /data/hello.txt
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The links the guest makes work on the host too.
+	if data, err := ioutil.ReadFile(filepath.Join(root, "data", "abs")); err != nil || string(data) != "hello from the host\n" {
+		t.Errorf("read link on the host: %q, %v", data, err)
+	}
+
+	written, err := ioutil.ReadFile(filepath.Join(root, "data", "new.txt"))
+	if err != nil || string(written) != "written by the guest\n" {
+		t.Errorf("host file: %q, %v", written, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "ro", "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("read-only mount was written: %v", err)
+	}
+}
+
+func TestHostFSConfinement(t *testing.T) {
+	root := hostTree(t)
+
+	fs, err := NewHostFS(filepath.Join(root, "data"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/escape", "/up", "/up/data/hello.txt"} {
+		if _, err := fs.Stat(name); fsError(err).Code != "EACCES" {
+			t.Errorf("stat %s: %v, want EACCES", name, err)
+		}
+	}
+	if err := fs.Chmod("/escape", 0777); fsError(err).Code != "EACCES" {
+		t.Errorf("chmod through escaping link: %v", err)
+	}
+
+	if fi, err := fs.Stat("/inside"); err != nil || !fi.IsDir() {
+		t.Errorf("stat link inside root: %v", err)
+	}
+	if err := fs.Unlink("/escape"); err != nil {
+		t.Errorf("unlink escaping link: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "secret.txt")); err != nil {
+		t.Errorf("link target removed: %v", err)
+	}
+
+	// Names from the guest are clean, but host code may pass others.
+	if err := fs.Rename("/hello.txt", "/../../moved.txt"); fsError(err).Code != "EACCES" {
+		t.Errorf("rename out of the root: %v", err)
+	}
+}
+
+func TestMountFSErrors(t *testing.T) {
+	fs := NewMountFS(NewMemFS())
+	if err := fs.Mount("/mnt/a", NewMemFS()); err != nil {
+		t.Fatal(err)
+	}
+
+	if fi, err := fs.Stat("/mnt"); err != nil || !fi.IsDir() {
+		t.Fatalf("mount point parent: %v", err)
+	}
+
+	f, err := fs.OpenFile("/mnt/a/file", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"rename across mounts", fs.Rename("/mnt/a/file", "/file"), "EXDEV"},
+		{"link across mounts", fs.Link("/mnt/a/file", "/file"), "EXDEV"},
+		{"rename mount point", fs.Rename("/mnt/a", "/b"), "EBUSY"},
+		{"rename parent of mount point", fs.Rename("/mnt", "/b"), "EBUSY"},
+		{"rmdir mount point", fs.Rmdir("/mnt/a"), "EBUSY"},
+		{"unlink mount point", fs.Unlink("/mnt/a"), "EISDIR"},
+	}
+	for _, tt := range tests {
+		if got := fsError(tt.err); got == nil || got.Code != tt.code {
+			t.Errorf("%s: got %v, want %s", tt.name, tt.err, tt.code)
+		}
+	}
+
+	names, err := fs.ReadDir("/mnt")
+	if err != nil || strings.Join(names, ",") != "a" {
+		t.Errorf("readdir: %v, %v", names, err)
+	}
+
+	// Relative and empty names are taken from the root.
+	for _, name := range []string{"mnt/a/file", "mnt/a/../a/file"} {
+		if _, err := fs.Stat(name); err != nil {
+			t.Errorf("stat %q: %v", name, err)
+		}
+	}
+	if names, err := fs.ReadDir(""); err != nil || strings.Join(names, ",") != "mnt" {
+		t.Errorf("readdir \"\": %v, %v", names, err)
+	}
+}
@@ -0,0 +1,31 @@
+package wasmvm
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// hostFileInfo returns fi, a host os.FileInfo, with a FileStat as Sys.
+func hostFileInfo(fi os.FileInfo) os.FileInfo {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi
+	}
+
+	return &fileInfo{
+		name:  fi.Name(),
+		size:  fi.Size(),
+		mode:  fi.Mode(),
+		mtime: fi.ModTime(),
+		stat: FileStat{
+			Dev:   uint64(st.Dev),
+			Ino:   uint64(st.Ino),
+			Nlink: uint64(st.Nlink),
+			UID:   int(st.Uid),
+			GID:   int(st.Gid),
+			Atime: time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec)),
+			Ctime: time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec)),
+		},
+	}
+}
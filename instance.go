@@ -0,0 +1,360 @@
+package wasmvm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// hostModules are the import module names used by the Go toolchain for the
+// GOOS=js host functions. Go 1.21 renamed "go" to "gojs".
+var hostModules = map[string]bool{
+	"go":   true,
+	"gojs": true,
+}
+
+// Instance is a loaded GOOS=js module bound to its own VM. Each Instance owns
+// its JavaScript globals and reference table, so several of them can run
+// concurrently in different goroutines.
+type Instance struct {
+	rt     *Runtime
+	module *wasm.Module
+	vm     *exec.VM
+
+	global map[string]interface{}
+	scope  map[string]interface{}
+
+	refs   *refTable
+	events *eventLoop
+	// files are the file descriptors of the guest.
+	files *fsModule
+
+	identity Identity
+	// cwd is the working directory of the guest.
+	cwd string
+
+	id string
+	// stdout and stderr receive the standard output and error of the guest.
+	stdout, stderr io.Writer
+	// flushOutput writes what the output formats still hold.
+	flushOutput func()
+
+	// clock is the time of the guest, which it counts from start.
+	clock Clock
+	start time.Time
+
+	// random is the entropy source of the guest.
+	random io.Reader
+
+	// exitCode is the code the guest exited with.
+	exitCode int
+
+	// depth counts the guest calls in progress, which are nested when host
+	// functions call back into the guest. calls counts all of them.
+	depth int
+	calls uint64
+}
+
+func newInstance(rt *Runtime) *Instance {
+	inst := &Instance{
+		rt: rt,
+		id: strconv.FormatUint(atomic.AddUint64(&rt.instances, 1), 10),
+		global: map[string]interface{}{
+			"Object": newObjectClass(),
+			"Array":  newArrayClass(),
+			"Error":  newErrorClass(),
+		},
+		scope: map[string]interface{}{
+			"exited":        false,
+			"_pendingEvent": nil,
+		},
+		events: newEventLoop(),
+
+		identity: rt.opts.Identity,
+		cwd:      cleanPath(rt.opts.Dir),
+
+		clock:       rt.opts.Clock,
+		random:      rt.opts.Random,
+		flushOutput: func() {},
+		exitCode:    -1,
+
+		stdout: rt.opts.Stdout,
+		stderr: rt.opts.Stderr,
+	}
+	if inst.stdout == nil {
+		inst.stdout = os.Stdout
+	}
+	if inst.stderr == nil {
+		inst.stderr = os.Stderr
+	}
+	if inst.clock == nil {
+		inst.clock = RealClock{}
+	}
+	if inst.random == nil {
+		inst.random = rand.Reader
+	}
+	inst.identity.Groups = append([]int(nil), rt.opts.Identity.Groups...)
+
+	for name, class := range newBufferClasses() {
+		inst.global[name] = class
+	}
+	fs := rt.opts.FS
+	if fs == nil {
+		mem := NewMemFS()
+		mem.SetClock(instanceClock{inst})
+		fs = mem
+	}
+	inst.global["fs"] = newFSImport(inst, fs)
+	inst.global["process"] = newProcessImport(inst)
+	inst.global["console"] = newConsole(inst)
+	inst.global["crypto"] = newCrypto(inst)
+	inst.scope["_resume"] = inst.resume
+	inst.scope["_makeFuncWrapper"] = inst.makeFuncWrapper
+	inst.refs = newRefTable(inst.global, inst.scope)
+
+	return inst
+}
+
+// Run executes the guest with the given command line. args[0] is the program
+// name, as in os.Args; when args is empty the program is named "js" like in
+// wasm_exec.js. Like there, the command line and Options.Env must fit in 8 KiB
+// of guest memory. Run keeps delivering timer and host events to the guest
+// until it exits or nothing can wake it up anymore. ctx is checked between
+// events. A guest exiting with a non-zero code makes Run return an
+// *ExitError.
+func (inst *Instance) Run(ctx context.Context, args []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		args = []string{"js"}
+	}
+
+	format := inst.rt.opts.OutputFormat
+	stdout, flushStdout := formatOutput(format, inst.stdout, inst.id, "stdout", inst.clock)
+	stderr, flushStderr := formatOutput(format, inst.stderr, inst.id, "stderr", inst.clock)
+	inst.stdout, inst.stderr = stdout, stderr
+	inst.flushOutput = func() {
+		_ = flushStdout()
+		_ = flushStderr()
+	}
+	defer inst.flushOutput()
+	defer inst.files.closeAll()
+
+	inst.start = inst.clock.Now()
+
+	argv, err := inst.writeArgs(args, inst.rt.opts.Env)
+	if err != nil {
+		return err
+	}
+
+	if _, err := inst.execExport("run", uint64(len(args)), uint64(argv)); err != nil {
+		return err
+	}
+	if err := inst.loop(ctx); err != nil {
+		return err
+	}
+
+	if inst.exitCode != 0 {
+		return &ExitError{Code: inst.exitCode}
+	}
+	return nil
+}
+
+// ExitError is returned by Run when the guest exits with a non-zero code,
+// such as with os.Exit(3), or when it panics or deadlocks, which exit with
+// code 2.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the code the guest exited with, or -1 if it has not
+// exited.
+func (inst *Instance) ExitCode() int {
+	return inst.exitCode
+}
+
+// Where wasm_exec.js writes the command line and environment of the guest:
+// from argsStart up to the data of the module, which the linker starts at
+// minDataAddr at the earliest.
+const (
+	argsStart   = 4096
+	minDataAddr = argsStart + 8192
+)
+
+// writeArgs writes args and env to the memory of the guest as wasm_exec.js
+// does, and returns the address of argv. The strings come first, each ending
+// with a zero byte and aligned to 8 bytes, then argv: the pointers to the
+// arguments and to the KEY=value entries of env, sorted by key, each list
+// ending with a null pointer.
+func (inst *Instance) writeArgs(args []string, env map[string]string) (int, error) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = key + "=" + env[key]
+	}
+
+	size := 0
+	for _, strs := range [][]string{args, entries} {
+		for _, s := range strs {
+			size += (len(s) + 8) &^ 7
+		}
+		size += 8 * (len(strs) + 1)
+	}
+	if argsStart+size >= minDataAddr {
+		return 0, errors.New("total length of command line and environment variables exceeds limit")
+	}
+
+	memory := inst.vm.Memory()
+	offset := argsStart
+	var ptrs []int
+	strPtrs := func(strs []string) {
+		for _, s := range strs {
+			ptrs = append(ptrs, offset)
+			offset += copy(memory[offset:], s)
+			memory[offset] = 0
+			offset = (offset + 8) &^ 7
+		}
+		ptrs = append(ptrs, 0)
+	}
+	strPtrs(args)
+	strPtrs(entries)
+
+	argv := offset
+	for _, ptr := range ptrs {
+		binary.LittleEndian.PutUint64(memory[offset:], uint64(ptr))
+		offset += 8
+	}
+
+	return argv, nil
+}
+
+func (inst *Instance) exited() bool {
+	return inst.scope["exited"].(bool)
+}
+
+// resume lets the guest handle the pending event, if any, and run until all
+// of its goroutines are blocked again.
+func (inst *Instance) resume() error {
+	if inst.exited() {
+		return errors.New("Go program has already exited")
+	}
+
+	_, err := inst.execExport("resume")
+	return err
+}
+
+// ID returns the ID of the instance, unique among those of its Runtime.
+func (inst *Instance) ID() string {
+	return inst.id
+}
+
+// SetOutput gives the instance its own standard output and error, which
+// replace those of the Options until Run returns. It must be called before
+// Run; a nil writer keeps the current one. To capture the output, pass
+// buffers.
+func (inst *Instance) SetOutput(stdout, stderr io.Writer) {
+	if stdout != nil {
+		inst.stdout = stdout
+	}
+	if stderr != nil {
+		inst.stderr = stderr
+	}
+}
+
+// SetClock replaces the clock of the instance, which Options.Clock gives
+// otherwise. It must be called before Run.
+func (inst *Instance) SetClock(c Clock) {
+	inst.clock = c
+}
+
+// SetRandom replaces the entropy source of the instance, which
+// Options.Random gives otherwise. Reads from it must fill the buffer or
+// fail; a failure stops the guest.
+func (inst *Instance) SetRandom(r io.Reader) {
+	inst.random = r
+}
+
+// Global returns the JavaScript global object of the instance. Host code can
+// add values for the guest to find with js.Global, and read back the ones the
+// guest sets, such as functions created with js.FuncOf. It must not be used
+// concurrently with the guest; see Post.
+func (inst *Instance) Global() map[string]interface{} {
+	return inst.global
+}
+
+// Post queues f to run between guest events while Run is delivering them. It
+// is safe to call from any goroutine, and f may call guest functions. If f
+// returns an error, Run stops and returns it.
+func (inst *Instance) Post(f func() error) {
+	inst.events.post(f)
+}
+
+func (inst *Instance) importer(name string) (*wasm.Module, error) {
+	if !hostModules[name] {
+		if inst.rt.opts.Resolve == nil {
+			return nil, fmt.Errorf("unknown import module %q", name)
+		}
+		return inst.rt.opts.Resolve(name)
+	}
+
+	m := wasm.NewModule()
+
+	sections := []wasm.FunctionSig{}
+	indexSpace := []wasm.Function{}
+	exports := map[string]wasm.ExportEntry{}
+
+	funcs := inst.hostFuncs()
+
+	for i, v := range funcNames {
+		sections = append(sections, wasm.FunctionSig{
+			Form:        uint8(i),
+			ParamTypes:  []wasm.ValueType{wasm.ValueTypeI32},
+			ReturnTypes: []wasm.ValueType{},
+		})
+		indexSpace = append(indexSpace, wasm.Function{
+			Sig:  &sections[i],
+			Host: reflect.ValueOf(funcs[v]),
+			Body: &wasm.FunctionBody{},
+		})
+		exports[v] = wasm.ExportEntry{
+			FieldStr: v,
+			Kind:     wasm.ExternalFunction,
+			Index:    uint32(i),
+		}
+	}
+
+	m.Types = &wasm.SectionTypes{
+		// One signature per host function, all of them (func [int32] -> [])
+		// taking the guest stack pointer.
+		Entries: sections,
+	}
+	m.FunctionIndexSpace = indexSpace
+
+	m.Export = &wasm.SectionExports{
+		Entries: exports,
+	}
+
+	return m, nil
+}
@@ -0,0 +1,68 @@
+package wasmvm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func loadApp(t *testing.T, rt *Runtime) *Instance {
+	t.Helper()
+	return loadWasm(t, rt, "app/main.wasm")
+}
+
+func loadWasm(t *testing.T, rt *Runtime, path string) *Instance {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	inst, err := rt.Load(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return inst
+}
+
+func TestParallelInstances(t *testing.T) {
+	rt := NewRuntime(Options{})
+
+	for i := 0; i < 4; i++ {
+		t.Run(fmt.Sprintf("instance%d", i), func(t *testing.T) {
+			t.Parallel()
+
+			inst := loadApp(t, rt)
+			if err := inst.Run(context.Background(), nil); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestInstancesDoNotShareState(t *testing.T) {
+	rt := NewRuntime(Options{})
+	a := newInstance(rt)
+	b := newInstance(rt)
+
+	a.global["answer"] = 42.0
+	a.scope["_pendingEvent"] = &wasmEvent{Id: 1}
+	a.global["fs"].(map[string]interface{})["extra"] = true
+
+	if _, ok := b.global["answer"]; ok {
+		t.Error("global leaked between instances")
+	}
+	if b.scope["_pendingEvent"] != nil {
+		t.Error("_pendingEvent leaked between instances")
+	}
+	if _, ok := b.global["fs"].(map[string]interface{})["extra"]; ok {
+		t.Error("fs object shared between instances")
+	}
+	if b.refs.get(refGlobal).(map[string]interface{})["answer"] != nil {
+		t.Error("reference table shared between instances")
+	}
+}
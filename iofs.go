@@ -0,0 +1,184 @@
+package wasmvm
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// IOFS is a read-only FS serving the files of an io/fs.FS, such as an
+// embed.FS or a *zip.Reader.
+type IOFS struct {
+	fsys fs.FS
+}
+
+// NewIOFS returns an FS for fsys.
+func NewIOFS(fsys fs.FS) *IOFS {
+	return &IOFS{fsys: fsys}
+}
+
+// ioName converts a clean absolute name to an io/fs name.
+func ioName(name string) string {
+	if name == "/" {
+		return "."
+	}
+	return name[1:]
+}
+
+// OpenFile implements FS.
+func (i *IOFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if writable(flag) || flag&(os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, errno("EROFS")
+	}
+
+	file, err := i.fsys.Open(ioName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ioFile{fsys: i.fsys, name: ioName(name), file: file}, nil
+}
+
+// Stat implements FS.
+func (i *IOFS) Stat(name string) (os.FileInfo, error) {
+	return fs.Stat(i.fsys, ioName(name))
+}
+
+// Lstat implements FS. An io/fs.FS has no symbolic links, so it is Stat.
+func (i *IOFS) Lstat(name string) (os.FileInfo, error) {
+	return i.Stat(name)
+}
+
+// ReadDir implements FS.
+func (i *IOFS) ReadDir(name string) ([]string, error) {
+	fi, err := i.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errno("ENOTDIR")
+	}
+
+	entries, err := fs.ReadDir(i.fsys, ioName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(entries))
+	for j, e := range entries {
+		names[j] = e.Name()
+	}
+
+	return names, nil
+}
+
+// Readlink implements FS. As there are no symbolic links, it fails with
+// EINVAL for any file that exists.
+func (i *IOFS) Readlink(name string) (string, error) {
+	if _, err := i.Stat(name); err != nil {
+		return "", err
+	}
+
+	return "", errno("EINVAL")
+}
+
+// IOFS is read-only, so every change fails with EROFS.
+
+func (i *IOFS) Mkdir(name string, perm os.FileMode) error         { return errno("EROFS") }
+func (i *IOFS) Unlink(name string) error                          { return errno("EROFS") }
+func (i *IOFS) Rmdir(name string) error                           { return errno("EROFS") }
+func (i *IOFS) Rename(oldname, newname string) error              { return errno("EROFS") }
+func (i *IOFS) Truncate(name string, size int64) error            { return errno("EROFS") }
+func (i *IOFS) Chmod(name string, mode os.FileMode) error         { return errno("EROFS") }
+func (i *IOFS) Chown(name string, uid, gid int) error             { return errno("EROFS") }
+func (i *IOFS) Lchown(name string, uid, gid int) error            { return errno("EROFS") }
+func (i *IOFS) Chtimes(name string, atime, mtime time.Time) error { return errno("EROFS") }
+func (i *IOFS) Link(oldname, newname string) error                { return errno("EROFS") }
+func (i *IOFS) Symlink(oldname, newname string) error             { return errno("EROFS") }
+
+// ioFile is a File of an IOFS. Files that cannot read at an offset, like
+// the compressed members of a zip archive, are read sequentially and opened
+// again to go back.
+type ioFile struct {
+	fsys fs.FS
+	name string
+	file fs.File
+	pos  int64
+}
+
+func (f *ioFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, errno("EINVAL")
+	}
+
+	if r, ok := f.file.(io.ReaderAt); ok {
+		return r.ReadAt(p, off)
+	}
+	if fi, err := f.file.Stat(); err == nil && fi.IsDir() {
+		return 0, errno("EISDIR")
+	}
+
+	if s, ok := f.file.(io.Seeker); ok {
+		if _, err := s.Seek(off, io.SeekStart); err != nil {
+			return 0, err
+		}
+		f.pos = off
+	}
+
+	if off < f.pos {
+		file, err := f.fsys.Open(f.name)
+		if err != nil {
+			return 0, err
+		}
+		f.file.Close()
+		f.file, f.pos = file, 0
+	}
+	if off > f.pos {
+		n, err := io.CopyN(io.Discard, f.file, off-f.pos)
+		f.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := io.ReadFull(f.file, p)
+	f.pos += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+func (f *ioFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, errno("EBADF")
+}
+
+func (f *ioFile) Stat() (os.FileInfo, error) {
+	if f.file == nil {
+		return nil, os.ErrClosed
+	}
+
+	return f.file.Stat()
+}
+
+func (f *ioFile) Close() error {
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+func (f *ioFile) Truncate(size int64) error    { return errno("EINVAL") }
+func (f *ioFile) Sync() error                  { return nil }
+func (f *ioFile) Chmod(mode os.FileMode) error { return errno("EROFS") }
+func (f *ioFile) Chown(uid, gid int) error     { return errno("EROFS") }
@@ -0,0 +1,210 @@
+package wasmvm
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"embed"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/readonly/main.wasm ./testdata/readonly
+
+//go:embed testdata/assets
+var assets embed.FS
+
+// walkAssets calls f with the name and contents of each file and directory
+// in testdata/assets, relative to it.
+func walkAssets(t *testing.T, f func(name string, data []byte, dir bool) error) {
+	t.Helper()
+
+	err := fs.WalkDir(assets, "testdata/assets", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || name == "testdata/assets" {
+			return err
+		}
+
+		var data []byte
+		if !d.IsDir() {
+			if data, err = assets.ReadFile(name); err != nil {
+				return err
+			}
+		}
+		return f(strings.TrimPrefix(name, "testdata/assets/"), data, d.IsDir())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func zipAssets(t *testing.T) *zip.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	walkAssets(t, func(name string, data []byte, dir bool) error {
+		if dir {
+			_, err := zw.Create(name + "/")
+			return err
+		}
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return zr
+}
+
+func tarAssets(t *testing.T) FS {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	walkAssets(t, func(name string, data []byte, dir bool) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if dir {
+			hdr.Mode, hdr.Typeflag = 0755, tar.TypeDir
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	})
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := NewTarFS(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fs
+}
+
+func TestReadOnlyFilesystems(t *testing.T) {
+	sub, err := fs.Sub(assets, "testdata/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := NewMountFS(NewMemFS())
+	for dir, fs := range map[string]FS{
+		"/embed": NewIOFS(sub),
+		"/zip":   NewIOFS(zipAssets(t)),
+		"/tar":   tarAssets(t),
+	} {
+		if err := mounts.Mount(dir, fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := runLogged(t, "testdata/readonly/main.wasm", func(inst *Instance) {
+		inst.global["fs"] = newFSImport(inst, mounts)
+	})
+
+	var want strings.Builder
+	for _, dir := range []string{"/embed", "/zip", "/tar"} {
+		want.WriteString(strings.ReplaceAll(`$DIR readfile: ok
+contents: "hello, assets\n"
+$DIR open: ok
+readat 7: "assets" <nil>
+readat 0: "hello," <nil>
+$DIR write: Bad file number
+$DIR close: ok
+$DIR readdir: ok
+entries: hello.txt(dir=false) sub(dir=true)
+$DIR stat: ok
+size: 5
+missing: true
+$DIR create: Read-only file system
+$DIR open for writing: Read-only file system
+$DIR remove: Read-only file system
+$DIR mkdir: Read-only file system
+$DIR chmod: Read-only file system
+`, "$DIR", dir))
+	}
+
+	if got != want.String() {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want.String())
+	}
+}
+
+func TestTarFSKeepsAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	hdr := &tar.Header{Name: "deep/dir/run.sh", Mode: 0750, Uid: 1000, Gid: 100, Size: 2, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("#!"))
+	tw.Close()
+
+	fs, err := NewTarFS(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := fs.Stat("/deep/dir/run.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStats(fi)
+	if s.Mode != 0100750 || s.UID != 1000 || s.GID != 100 || s.Size != 2 {
+		t.Errorf("stat: mode %o, owner %d:%d, size %d", s.Mode, s.UID, s.GID, s.Size)
+	}
+	if fi, err := fs.Stat("/deep"); err != nil || !fi.IsDir() {
+		t.Errorf("parent directory: %v", err)
+	}
+
+	if _, err := fs.OpenFile("/deep/dir/run.sh", os.O_RDWR, 0); fsError(err).Code != "EROFS" {
+		t.Errorf("open for writing: %v", err)
+	}
+}
+
+func TestTarFSLinks(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "bin/tool", Mode: 0755, Size: 2, Typeflag: tar.TypeReg},
+		{Name: "bin/alias", Linkname: "bin/tool", Typeflag: tar.TypeLink},
+		{Name: "usr/bin", Linkname: "../bin", Typeflag: tar.TypeSymlink},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(make([]byte, hdr.Size))
+	}
+	tw.Close()
+
+	fs, err := NewTarFS(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := fs.Stat("/usr/bin/alias")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := newStats(fi); s.Nlink != 2 || s.Size != 2 {
+		t.Errorf("hard link through symbolic link: nlink %d, size %d", s.Nlink, s.Size)
+	}
+	if target, err := fs.Readlink("/usr/bin"); target != "../bin" || err != nil {
+		t.Errorf("readlink: %q, %v", target, err)
+	}
+	if fi, err := fs.Lstat("/usr/bin"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("lstat: %v, %v", fi, err)
+	}
+}
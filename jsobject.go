@@ -0,0 +1,63 @@
+package wasmvm
+
+import (
+	"sort"
+	"strconv"
+)
+
+// JSObject is implemented by host values that define their own JavaScript
+// behaviour. The syscall/js bridge functions use it before looking at the
+// value through reflection.
+type JSObject interface {
+	// Get returns the property key, or Undefined if there is none.
+	Get(key string) interface{}
+	// Set sets the property key to value.
+	Set(key string, value interface{})
+	// Delete removes the property key.
+	Delete(key string)
+	// Call calls the method name with the given arguments. A returned
+	// error is thrown into the guest.
+	Call(name string, args []interface{}) (interface{}, error)
+	// Index returns the element i, or Undefined if there is none.
+	Index(i int) interface{}
+	// Keys returns the names of the enumerable properties, as
+	// Object.keys does.
+	Keys() []string
+	// InstanceOf reports whether the object is an instance of constructor.
+	InstanceOf(constructor interface{}) bool
+}
+
+// keys returns the enumerable property names of v, like Object.keys.
+// JavaScript lists keys in insertion order; Go maps have none, so map keys
+// are sorted.
+func keys(v interface{}) []string {
+	if o, ok := v.(JSObject); ok {
+		return o.Keys()
+	}
+
+	if m, ok := v.(map[string]interface{}); ok {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	n := 0
+	if t, ok := v.(*TypedArray); ok {
+		n = t.Len()
+	} else if a, ok := arrayOf(v); ok {
+		n = a.Len()
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = strconv.Itoa(i)
+	}
+
+	if _, b, ok := structValue(v); ok {
+		names = append(names, b.names...)
+	}
+
+	return names
+}
@@ -0,0 +1,103 @@
+package wasmvm
+
+import (
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/jsobject/main.wasm ./testdata/jsobject
+
+// testStore is a JSObject holding named properties and a list of items,
+// exposed as the properties "0", "1", and so on.
+type testStore struct {
+	class *Class
+	props map[string]interface{}
+	items []interface{}
+}
+
+func (s *testStore) Get(key string) interface{} {
+	if key == "length" {
+		return len(s.items)
+	}
+	if i, err := strconv.Atoi(key); err == nil {
+		return s.Index(i)
+	}
+	if v, ok := s.props[key]; ok {
+		return v
+	}
+	return Undefined
+}
+
+func (s *testStore) Set(key string, value interface{}) {
+	if i, err := strconv.Atoi(key); err == nil && i >= 0 {
+		for len(s.items) <= i {
+			s.items = append(s.items, Undefined)
+		}
+		s.items[i] = value
+		return
+	}
+	s.props[key] = value
+}
+
+func (s *testStore) Delete(key string) {
+	delete(s.props, key)
+}
+
+func (s *testStore) Call(name string, args []interface{}) (interface{}, error) {
+	if name != "sum" {
+		return nil, errors.New("store." + name + " is not a function")
+	}
+	sum := 0.0
+	for _, arg := range args {
+		sum += toNumber(arg)
+	}
+	return sum, nil
+}
+
+func (s *testStore) Index(i int) interface{} {
+	if i < 0 || i >= len(s.items) {
+		return Undefined
+	}
+	return s.items[i]
+}
+
+func (s *testStore) Keys() []string {
+	var names []string
+	for i := range s.items {
+		names = append(names, strconv.Itoa(i))
+	}
+	var props []string
+	for name := range s.props {
+		props = append(props, name)
+	}
+	sort.Strings(props)
+	return append(names, props...)
+}
+
+func (s *testStore) InstanceOf(constructor interface{}) bool {
+	return constructor == s.class
+}
+
+func TestJSObject(t *testing.T) {
+	want, err := ioutil.ReadFile("testdata/jsobject/want.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := runLogged(t, "testdata/jsobject/main.wasm", func(inst *Instance) {
+		class := &Class{Name: "Store"}
+		inst.Global()["Store"] = class
+		inst.Global()["store"] = &testStore{
+			class: class,
+			props: map[string]interface{}{"name": "gopher"},
+			items: []interface{}{"first"},
+		}
+	})
+
+	if got != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,227 @@
+package wasmvm
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type undefined struct{}
+
+// Undefined is the JavaScript undefined value. nil is null.
+var Undefined = undefined{}
+
+// Class is a JavaScript class implemented by the host. New is the function
+// called by the new operator; its first result type is the type of the
+// instances. Like in JavaScript, calling a class without new throws.
+type Class struct {
+	Name string
+	New  interface{}
+	// Static holds the properties of the class itself, like Array.isArray.
+	Static map[string]interface{}
+
+	// instance overrides the instanceof check based on the result of New.
+	instance func(v interface{}) bool
+}
+
+// construct creates an instance of c from guest arguments.
+func (c *Class) construct(args []interface{}) (interface{}, error) {
+	return callFunc(c.New, nil, args)
+}
+
+// isInstance reports whether v instanceof c holds.
+func (c *Class) isInstance(v interface{}) bool {
+	if o, ok := v.(JSObject); ok {
+		return o.InstanceOf(c)
+	}
+	if c.instance != nil {
+		return c.instance(v)
+	}
+
+	t := reflect.TypeOf(c.New)
+	if v == nil || t == nil || t.Kind() != reflect.Func || t.NumOut() == 0 {
+		return false
+	}
+
+	return reflect.TypeOf(v) == t.Out(0)
+}
+
+// newObjectClass returns the Object class, which every object and function
+// is an instance of.
+func newObjectClass() *Class {
+	return &Class{
+		Name: "Object",
+		New: func() map[string]interface{} {
+			return map[string]interface{}{}
+		},
+		Static: map[string]interface{}{
+			"keys": keys,
+		},
+		instance: isObject,
+	}
+}
+
+// newErrorClass returns the Error class, whose instances are *Error.
+func newErrorClass() *Class {
+	return &Class{
+		Name: "Error",
+		New: func(message string) *Error {
+			return &Error{Message: message}
+		},
+	}
+}
+
+// isObject reports whether v is a JavaScript object or function rather than
+// a primitive value.
+func isObject(v interface{}) bool {
+	switch v.(type) {
+	case nil, undefined, bool, string, *Symbol:
+		return false
+	}
+
+	return !isNumberKind(reflect.TypeOf(v).Kind())
+}
+
+// property returns obj[key], or undefined when obj has no such property.
+func property(obj interface{}, key string) interface{} {
+	switch o := obj.(type) {
+	case JSObject:
+		return o.Get(key)
+	case map[string]interface{}:
+		if v, ok := o[key]; ok {
+			return v
+		}
+		return Undefined
+	case *TypedArray:
+		return o.get(key)
+	case *ArrayBuffer:
+		return o.get(key)
+	case *DataView:
+		return o.get(key)
+	case *Class:
+		if v, ok := o.Static[key]; ok {
+			return v
+		}
+		if key == "name" {
+			return o.Name
+		}
+		return Undefined
+	}
+
+	if a, ok := arrayOf(obj); ok {
+		if key == "length" {
+			return a.Len()
+		}
+		return Undefined
+	}
+
+	if v, ok := structProperty(obj, key); ok {
+		return v
+	}
+
+	return Undefined
+}
+
+// toNumber converts v to a number the way Number(v) does in JavaScript.
+func toNumber(v interface{}) float64 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case undefined:
+		return math.NaN()
+	case bool:
+		if x {
+			return 1
+		}
+		return 0
+	case float64:
+		return x
+	case string:
+		s := strings.TrimSpace(x)
+		if s == "" {
+			return 0
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+		return math.NaN()
+	}
+
+	if rv := reflect.ValueOf(v); isNumberKind(rv.Kind()) {
+		return rv.Convert(reflect.TypeOf(0.0)).Float()
+	}
+
+	return math.NaN()
+}
+
+// jsString converts v to a string the way String(v) does in JavaScript.
+func jsString(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case undefined:
+		return "undefined"
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return numberString(x)
+	case *Error:
+		return "Error: " + x.Message
+	case *Class:
+		return "class " + x.Name + " { [native code] }"
+	case *Symbol:
+		return "Symbol(" + x.Description + ")"
+	}
+
+	if a, ok := arrayOf(v); ok {
+		parts := make([]string, a.Len())
+		for i := range parts {
+			if e := index(v, i); e != nil && e != Undefined {
+				parts[i] = jsString(e)
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+
+	rv := reflect.ValueOf(v)
+	if isNumberKind(rv.Kind()) {
+		return numberString(rv.Convert(reflect.TypeOf(0.0)).Float())
+	}
+	if typeFlagOf(v) == typeFlagFunction {
+		return "function () { [native code] }"
+	}
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return "[object Object]"
+}
+
+// numberString formats f like Number.prototype.toString does.
+func numberString(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+
+	if abs := math.Abs(f); abs < 1e21 && abs >= 1e-6 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	// JavaScript writes exponents without leading zeros, as in 1.5e-7.
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	i := strings.IndexByte(s, 'e')
+	mantissa, sign, exp := s[:i], s[i+1:i+2], strings.TrimLeft(s[i+2:], "0")
+
+	return mantissa + "e" + sign + exp
+}
@@ -0,0 +1,722 @@
+package wasmvm
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a writable FS kept in memory. It is safe for concurrent use, so
+// several instances can share one. File times come from the host clock,
+// unless SetClock gives another; the MemFS an instance makes for itself uses
+// the clock of the instance.
+type MemFS struct {
+	mu    sync.Mutex
+	root  *memNode
+	ino   uint64
+	clock Clock
+}
+
+// memNode is a file, directory or symbolic link of a MemFS. The data of a
+// symbolic link is its target.
+type memNode struct {
+	mode    os.FileMode
+	data    []byte
+	entries map[string]*memNode
+	// links counts the directory entries of the node.
+	links int
+
+	ino                 uint64
+	uid, gid            int
+	atime, mtime, ctime time.Time
+
+	fs *MemFS
+}
+
+// NewMemFS returns an empty MemFS, with only its root directory.
+func NewMemFS() *MemFS {
+	fs := &MemFS{clock: RealClock{}}
+	fs.root = fs.newNode(os.ModeDir | 0755)
+	return fs
+}
+
+// SetClock replaces the clock the file times come from.
+func (fs *MemFS) SetClock(c Clock) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.clock = c
+}
+
+// now returns the time on the clock of fs.
+func (fs *MemFS) now() time.Time {
+	return fs.clock.Now()
+}
+
+func (fs *MemFS) newNode(mode os.FileMode) *memNode {
+	fs.ino++
+	now := fs.now()
+
+	n := &memNode{
+		mode:  mode,
+		ino:   fs.ino,
+		atime: now,
+		mtime: now,
+		ctime: now,
+		fs:    fs,
+	}
+	if mode.IsDir() {
+		n.entries = map[string]*memNode{}
+	}
+
+	return n
+}
+
+// touch records a change of the contents of n.
+func (n *memNode) touch() {
+	n.mtime = n.fs.now()
+	n.ctime = n.mtime
+}
+
+// walk resolves name. It returns the directory holding the file name refers
+// to, the name of the file in that directory and the file, or nil if there is
+// no such file. For the root directory, dir is nil and base is empty.
+// Symbolic links are followed, except as the last element of name when
+// follow is false.
+func (fs *MemFS) walk(name string, follow bool) (dir *memNode, base string, n *memNode, err error) {
+	// The directories leading to the current one, and their names.
+	dirs := []*memNode{fs.root}
+	names := []string{""}
+	rest := strings.Split(name, "/")
+	links := 0
+
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if !dirs[len(dirs)-1].mode.IsDir() {
+				return nil, "", nil, errno("ENOTDIR")
+			}
+			if len(dirs) > 1 {
+				dirs, names = dirs[:len(dirs)-1], names[:len(names)-1]
+			}
+			continue
+		}
+
+		cur := dirs[len(dirs)-1]
+		if !cur.mode.IsDir() {
+			return nil, "", nil, errno("ENOTDIR")
+		}
+
+		last := true
+		for _, r := range rest {
+			if r != "" && r != "." {
+				last = false
+				break
+			}
+		}
+		child := cur.entries[elem]
+		switch {
+		case child == nil && last:
+			return cur, elem, nil, nil
+		case child == nil:
+			return nil, "", nil, errno("ENOENT")
+		case child.mode&os.ModeSymlink != 0 && (follow || !last):
+			if links++; links > maxSymlinks {
+				return nil, "", nil, errno("ELOOP")
+			}
+			target := string(child.data)
+			if strings.HasPrefix(target, "/") {
+				dirs, names = dirs[:1], names[:1]
+			}
+			rest = append(strings.Split(target, "/"), rest...)
+		case last:
+			return cur, elem, child, nil
+		default:
+			dirs, names = append(dirs, child), append(names, elem)
+		}
+	}
+
+	// name ends with a directory reached through ".." or a link.
+	if len(dirs) == 1 {
+		return nil, "", fs.root, nil
+	}
+	return dirs[len(dirs)-2], names[len(names)-1], dirs[len(dirs)-1], nil
+}
+
+// lookup returns the node named name, following symbolic links.
+func (fs *MemFS) lookup(name string) (*memNode, error) {
+	return fs.lookupLink(name, true)
+}
+
+// lookupLink returns the node named name, following a symbolic link as the
+// last element of name only if follow is set.
+func (fs *MemFS) lookupLink(name string, follow bool) (*memNode, error) {
+	_, _, n, err := fs.walk(name, follow)
+	if err == nil && n == nil {
+		err = errno("ENOENT")
+	}
+
+	return n, err
+}
+
+// lookupParent returns the directory holding name and the base name of name,
+// without following a symbolic link as the last element of name. The base
+// name is empty for the root directory.
+func (fs *MemFS) lookupParent(name string) (*memNode, string, error) {
+	dir, base, _, err := fs.walk(name, false)
+	return dir, base, err
+}
+
+// link adds n to the directory d as name.
+func (d *memNode) link(name string, n *memNode) {
+	if old := d.entries[name]; old != nil {
+		old.links--
+	}
+	d.entries[name] = n
+	n.links++
+	d.touch()
+}
+
+// unlink removes the entry name of the directory d.
+func (d *memNode) unlink(name string) {
+	d.entries[name].links--
+	delete(d.entries, name)
+	d.touch()
+}
+
+// OpenFile implements FS.
+func (fs *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// O_EXCL fails on a symbolic link, even a dangling one.
+	parent, base, n, err := fs.walk(name, flag&os.O_EXCL == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case n == nil && flag&os.O_CREATE == 0:
+		return nil, errno("ENOENT")
+	case n == nil:
+		n = fs.newNode(perm.Perm())
+		parent.link(base, n)
+	case flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, errno("EEXIST")
+	case n.mode.IsDir() && (writable(flag) || flag&os.O_TRUNC != 0):
+		return nil, errno("EISDIR")
+	case flag&os.O_TRUNC != 0 && len(n.data) > 0:
+		n.data = nil
+		n.touch()
+	}
+
+	return &memFile{fs: fs, node: n, name: name, flag: flag}, nil
+}
+
+// writable reports whether files opened with flag can be written.
+func writable(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+// Stat implements FS.
+func (fs *MemFS) Stat(name string) (os.FileInfo, error) {
+	return fs.stat(name, true)
+}
+
+// Lstat implements FS.
+func (fs *MemFS) Lstat(name string) (os.FileInfo, error) {
+	return fs.stat(name, false)
+}
+
+func (fs *MemFS) stat(name string, follow bool) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookupLink(name, follow)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.info(path.Base(name)), nil
+}
+
+// ReadDir implements FS.
+func (fs *MemFS) ReadDir(name string) ([]string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if !n.mode.IsDir() {
+		return nil, errno("ENOTDIR")
+	}
+
+	names := make([]string, 0, len(n.entries))
+	for name := range n.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Mkdir implements FS.
+func (fs *MemFS) Mkdir(name string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	parent, base, err := fs.lookupParent(name)
+	if err != nil {
+		return err
+	}
+	if base == "" || parent.entries[base] != nil {
+		return errno("EEXIST")
+	}
+
+	parent.link(base, fs.newNode(os.ModeDir|perm.Perm()))
+
+	return nil
+}
+
+// Unlink implements FS.
+func (fs *MemFS) Unlink(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	parent, base, err := fs.lookupParent(name)
+	if err != nil {
+		return err
+	}
+	if base == "" {
+		return errno("EISDIR")
+	}
+
+	n, ok := parent.entries[base]
+	switch {
+	case !ok:
+		return errno("ENOENT")
+	case n.mode.IsDir():
+		return errno("EISDIR")
+	}
+
+	parent.unlink(base)
+
+	return nil
+}
+
+// Rmdir implements FS.
+func (fs *MemFS) Rmdir(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	parent, base, err := fs.lookupParent(name)
+	if err != nil {
+		return err
+	}
+	if base == "" {
+		return errno("EBUSY")
+	}
+
+	n, ok := parent.entries[base]
+	switch {
+	case !ok:
+		return errno("ENOENT")
+	case !n.mode.IsDir():
+		return errno("ENOTDIR")
+	case len(n.entries) > 0:
+		return errno("ENOTEMPTY")
+	}
+
+	parent.unlink(base)
+
+	return nil
+}
+
+// Rename implements FS.
+func (fs *MemFS) Rename(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	oldParent, oldBase, err := fs.lookupParent(oldname)
+	if err != nil {
+		return err
+	}
+	newParent, newBase, err := fs.lookupParent(newname)
+	if err != nil {
+		return err
+	}
+	if oldBase == "" || newBase == "" {
+		return errno("EBUSY")
+	}
+
+	n, ok := oldParent.entries[oldBase]
+	if !ok {
+		return errno("ENOENT")
+	}
+	if oldname == newname {
+		return nil
+	}
+	if n.mode.IsDir() && strings.HasPrefix(newname, oldname+"/") {
+		return errno("EINVAL")
+	}
+
+	if target, ok := newParent.entries[newBase]; ok {
+		switch {
+		case target == n:
+			// Both names are links to the same file.
+			return nil
+		case n.mode.IsDir() && !target.mode.IsDir():
+			return errno("ENOTDIR")
+		case !n.mode.IsDir() && target.mode.IsDir():
+			return errno("EISDIR")
+		case len(target.entries) > 0:
+			return errno("ENOTEMPTY")
+		}
+	}
+
+	oldParent.unlink(oldBase)
+	newParent.link(newBase, n)
+	n.ctime = n.fs.now()
+
+	return nil
+}
+
+// Truncate implements FS.
+func (fs *MemFS) Truncate(name string, size int64) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	return n.truncate(size)
+}
+
+func (n *memNode) truncate(size int64) error {
+	switch {
+	case n.mode.IsDir():
+		return errno("EISDIR")
+	case size < 0:
+		return errno("EINVAL")
+	}
+
+	if size <= int64(len(n.data)) {
+		n.data = n.data[:size]
+	} else {
+		n.data = append(n.data, make([]byte, size-int64(len(n.data)))...)
+	}
+	n.touch()
+
+	return nil
+}
+
+// Chmod implements FS.
+func (fs *MemFS) Chmod(name string, mode os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	n.chmod(mode)
+
+	return nil
+}
+
+func (n *memNode) chmod(mode os.FileMode) {
+	const bits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+	n.mode = n.mode&^bits | mode&bits
+	n.ctime = n.fs.now()
+}
+
+// Chown implements FS.
+func (fs *MemFS) Chown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	n.chown(uid, gid)
+
+	return nil
+}
+
+// chown changes the owner of n. Like in os.Chown, -1 keeps the current value.
+func (n *memNode) chown(uid, gid int) {
+	if uid != -1 {
+		n.uid = uid
+	}
+	if gid != -1 {
+		n.gid = gid
+	}
+	n.ctime = n.fs.now()
+}
+
+// Lchown implements FS.
+func (fs *MemFS) Lchown(name string, uid, gid int) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookupLink(name, false)
+	if err != nil {
+		return err
+	}
+	n.chown(uid, gid)
+
+	return nil
+}
+
+// Chtimes implements FS.
+func (fs *MemFS) Chtimes(name string, atime, mtime time.Time) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookup(name)
+	if err != nil {
+		return err
+	}
+	n.atime = atime
+	n.mtime = mtime
+	n.ctime = n.fs.now()
+
+	return nil
+}
+
+// Link implements FS. Like on Linux, a symbolic link oldname is not
+// followed, and directories cannot be linked.
+func (fs *MemFS) Link(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookupLink(oldname, false)
+	if err != nil {
+		return err
+	}
+	if n.mode.IsDir() {
+		return errno("EPERM")
+	}
+
+	parent, base, err := fs.lookupParent(newname)
+	if err != nil {
+		return err
+	}
+	if base == "" || parent.entries[base] != nil {
+		return errno("EEXIST")
+	}
+
+	parent.link(base, n)
+	n.ctime = n.fs.now()
+
+	return nil
+}
+
+// Symlink implements FS. The target is stored as given; it is resolved
+// relative to the directory of the link when followed.
+func (fs *MemFS) Symlink(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	parent, base, err := fs.lookupParent(newname)
+	if err != nil {
+		return err
+	}
+	if base == "" || parent.entries[base] != nil {
+		return errno("EEXIST")
+	}
+
+	n := fs.newNode(os.ModeSymlink | 0777)
+	n.data = []byte(oldname)
+	parent.link(base, n)
+
+	return nil
+}
+
+// Readlink implements FS.
+func (fs *MemFS) Readlink(name string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	n, err := fs.lookupLink(name, false)
+	if err != nil {
+		return "", err
+	}
+	if n.mode&os.ModeSymlink == 0 {
+		return "", errno("EINVAL")
+	}
+
+	return string(n.data), nil
+}
+
+// info describes n, which is named name.
+func (n *memNode) info(name string) os.FileInfo {
+	nlink := uint64(n.links)
+	if n.mode.IsDir() {
+		nlink = 2
+		for _, child := range n.entries {
+			if child.mode.IsDir() {
+				nlink++
+			}
+		}
+	}
+
+	return &fileInfo{
+		name:  name,
+		size:  int64(len(n.data)),
+		mode:  n.mode,
+		mtime: n.mtime,
+		stat: FileStat{
+			Ino:   n.ino,
+			Nlink: nlink,
+			UID:   n.uid,
+			GID:   n.gid,
+			Atime: n.atime,
+			Ctime: n.ctime,
+		},
+	}
+}
+
+// memFile is a file of a MemFS opened with flag. It keeps working on the file
+// after it is unlinked or renamed, like on Unix.
+type memFile struct {
+	fs     *MemFS
+	node   *memNode
+	name   string
+	flag   int
+	closed bool
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	switch {
+	case f.closed:
+		return 0, os.ErrClosed
+	case f.node.mode.IsDir():
+		return 0, errno("EISDIR")
+	case f.flag&os.O_WRONLY != 0:
+		return 0, errno("EBADF")
+	case off < 0:
+		return 0, errno("EINVAL")
+	case off >= int64(len(f.node.data)):
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	switch {
+	case f.closed:
+		return 0, os.ErrClosed
+	case !writable(f.flag):
+		return 0, errno("EBADF")
+	case off < 0:
+		return 0, errno("EINVAL")
+	}
+
+	if end := off + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[off:], p)
+	f.node.touch()
+
+	return len(p), nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, os.ErrClosed
+	}
+
+	return f.node.info(path.Base(f.name)), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	switch {
+	case f.closed:
+		return os.ErrClosed
+	case !writable(f.flag):
+		return errno("EINVAL")
+	}
+
+	return f.node.truncate(size)
+}
+
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+
+	return nil
+}
+
+func (f *memFile) Chmod(mode os.FileMode) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.node.chmod(mode)
+
+	return nil
+}
+
+func (f *memFile) Chown(uid, gid int) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.node.chown(uid, gid)
+
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+
+	return nil
+}
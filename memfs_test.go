@@ -0,0 +1,170 @@
+package wasmvm
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMemFSErrors(t *testing.T) {
+	fs := NewMemFS()
+	if err := fs.Mkdir("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("/dir/file", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"open missing", openErr(fs, "/missing", os.O_RDONLY), "ENOENT"},
+		{"open exclusive", openErr(fs, "/dir/file", os.O_CREATE|os.O_EXCL|os.O_WRONLY), "EEXIST"},
+		{"open dir for writing", openErr(fs, "/dir", os.O_WRONLY), "EISDIR"},
+		{"open through file", openErr(fs, "/dir/file/x", os.O_RDONLY), "ENOTDIR"},
+		{"mkdir root", fs.Mkdir("/", 0755), "EEXIST"},
+		{"rmdir root", fs.Rmdir("/"), "EBUSY"},
+		{"rmdir not empty", fs.Rmdir("/dir"), "ENOTEMPTY"},
+		{"unlink dir", fs.Unlink("/dir"), "EISDIR"},
+		{"rename into itself", fs.Rename("/dir", "/dir/sub"), "EINVAL"},
+		{"truncate dir", fs.Truncate("/dir", 0), "EISDIR"},
+		{"readlink file", readlinkErr(fs, "/dir/file"), "EINVAL"},
+	}
+
+	for _, tt := range tests {
+		if got := fsError(tt.err); got == nil || got.Code != tt.code {
+			t.Errorf("%s: got %v, want %s", tt.name, tt.err, tt.code)
+		}
+	}
+}
+
+// Only "" and "." end a name; other names made of dots are files, and ".."
+// in a link target leads to the parent directory.
+func TestMemFSDots(t *testing.T) {
+	fs := NewMemFS()
+	for _, dir := range []string{"/a", "/a/d"} {
+		if err := fs.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := fs.OpenFile("/a/...", os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if fi, err := fs.Stat("/a/..."); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("stat /a/...: %v, %v", fi, err)
+	}
+
+	if err := fs.Symlink("d/..", "/a/l"); err != nil {
+		t.Fatal(err)
+	}
+	a, err := fs.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("/a/l"); err != nil || fi.Sys().(*FileStat).Ino != a.Sys().(*FileStat).Ino {
+		t.Errorf("stat /a/l: %v, %v, want /a", fi, err)
+	}
+	if _, err := fs.Stat("/a/.../.."); fsError(err).Code != "ENOTDIR" {
+		t.Errorf("stat /a/.../..: %v, want ENOTDIR", err)
+	}
+}
+
+// An exclusive create does not follow a dangling link.
+func TestMemFSExclusiveCreateOfLink(t *testing.T) {
+	fs := NewMemFS()
+	if err := fs.Symlink("/target", "/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := openErr(fs, "/link", os.O_CREATE|os.O_EXCL|os.O_WRONLY); fsError(err).Code != "EEXIST" {
+		t.Errorf("exclusive create of link: %v, want EEXIST", err)
+	}
+	if _, err := fs.Lstat("/target"); fsError(err).Code != "ENOENT" {
+		t.Errorf("link target created: %v", err)
+	}
+
+	if err := openErr(fs, "/link", os.O_CREATE|os.O_WRONLY); err != nil {
+		t.Errorf("create through link: %v", err)
+	}
+	if _, err := fs.Lstat("/target"); err != nil {
+		t.Errorf("link target not created: %v", err)
+	}
+}
+
+func openErr(fs FS, name string, flag int) error {
+	f, err := fs.OpenFile(name, flag, 0644)
+	if err == nil {
+		f.Close()
+	}
+	return err
+}
+
+func readlinkErr(fs FS, name string) error {
+	_, err := fs.Readlink(name)
+	return err
+}
+
+func TestMemFSUnlinkedFilesStayOpen(t *testing.T) {
+	fs := NewMemFS()
+
+	f, err := fs.OpenFile("/tmp", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteAt([]byte("data"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Unlink("/tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/tmp"); fsError(err).Code != "ENOENT" {
+		t.Errorf("stat after unlink: %v", err)
+	}
+
+	buf := make([]byte, 8)
+	n, err := f.ReadAt(buf, 0)
+	if err != io.EOF || string(buf[:n]) != "data" {
+		t.Errorf("read after unlink: %d %q %v", n, buf[:n], err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	fs := NewMemFS()
+	if err := fs.Mkdir("/dir", 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("/dir/sub", 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Chown("/dir", 1000, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := fs.Stat("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStats(fi)
+
+	if s.Mode != 040750 || !s.IsDirectory() || s.IsFile() {
+		t.Errorf("mode = %o", s.Mode)
+	}
+	if s.Nlink != 3 {
+		t.Errorf("nlink = %d, want 3", s.Nlink)
+	}
+	if s.UID != 1000 || s.GID != 100 {
+		t.Errorf("owner = %d:%d, want 1000:100", s.UID, s.GID)
+	}
+	if s.MtimeMs == 0 || s.CtimeMs < s.MtimeMs {
+		t.Errorf("times: mtime %d, ctime %d", s.MtimeMs, s.CtimeMs)
+	}
+}
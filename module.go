@@ -0,0 +1,128 @@
+package wasmvm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+const sectionIDData = 11
+
+type dataSegment struct {
+	offset []byte
+	data   []byte
+}
+
+// readModule works like wasm.ReadModule but initializes the linear memory
+// itself. wagon reallocates the whole memory for every data segment, which
+// for a Go binary with thousands of segments dominates the load time.
+func readModule(r io.Reader, resolve wasm.ResolveFunc) (*wasm.Module, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stripped, segments, err := splitDataSection(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := wasm.ReadModule(bytes.NewReader(stripped), resolve)
+	if err != nil {
+		return nil, err
+	}
+
+	size := uint64(0)
+	offsets := make([]uint64, len(segments))
+	for i, seg := range segments {
+		v, err := m.ExecInitExpr(seg.offset)
+		if err != nil {
+			return nil, err
+		}
+		off, ok := v.(int32)
+		if !ok {
+			return nil, fmt.Errorf("data segment %d: offset is %T, expected int32", i, v)
+		}
+		offsets[i] = uint64(uint32(off))
+		if end := offsets[i] + uint64(len(seg.data)); end > size {
+			size = end
+		}
+	}
+
+	memory := make([]byte, size)
+	for i, seg := range segments {
+		copy(memory[offsets[i]:], seg.data)
+	}
+	m.LinearMemoryIndexSpace[0] = memory
+
+	return m, nil
+}
+
+// splitDataSection returns raw without its data section, along with the
+// segments that section contained.
+func splitDataSection(raw []byte) ([]byte, []dataSegment, error) {
+	if len(raw) < 8 {
+		return nil, nil, errors.New("module too short")
+	}
+
+	out := make([]byte, 0, len(raw))
+	out = append(out, raw[:8]...) // magic and version
+	var segments []dataSegment
+
+	pos := 8
+	for pos < len(raw) {
+		id := raw[pos]
+		size, l := readULEB128(raw[pos+1:])
+		start := pos + 1 + l
+		end := start + int(size)
+		if end > len(raw) {
+			return nil, nil, fmt.Errorf("section %d overflows module", id)
+		}
+
+		if id != sectionIDData {
+			out = append(out, raw[pos:end]...)
+			pos = end
+			continue
+		}
+
+		payload := raw[start:end]
+		count, n := readULEB128(payload)
+		payload = payload[n:]
+		for i := uint64(0); i < count; i++ {
+			memIdx, n := readULEB128(payload)
+			if memIdx != 0 {
+				return nil, nil, wasm.InvalidLinearMemoryIndexError(uint32(memIdx))
+			}
+			payload = payload[n:]
+
+			// Offsets are a single i32.const or global.get followed by end.
+			if len(payload) == 0 || (payload[0] != 0x41 && payload[0] != 0x23) {
+				return nil, nil, fmt.Errorf("data segment %d: unsupported offset expression", i)
+			}
+			exprEnd := skipLEB128(payload, 1)
+			if exprEnd >= len(payload) || payload[exprEnd] != 0x0b {
+				return nil, nil, fmt.Errorf("data segment %d: unterminated offset expression", i)
+			}
+			offset := payload[:exprEnd+1]
+			payload = payload[exprEnd+1:]
+
+			dataLen, n := readULEB128(payload)
+			payload = payload[n:]
+			if uint64(len(payload)) < dataLen {
+				return nil, nil, fmt.Errorf("data segment %d overflows section", i)
+			}
+			segments = append(segments, dataSegment{
+				offset: offset,
+				data:   payload[:dataLen],
+			})
+			payload = payload[dataLen:]
+		}
+		pos = end
+	}
+
+	return out, segments, nil
+}
@@ -0,0 +1,341 @@
+package wasmvm
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MountFS combines filesystems mounted at directories of the guest, like the
+// mount table of Unix. Each name is served by the FS mounted at the longest
+// directory holding it. Renames and links between filesystems fail with
+// EXDEV, and mount points cannot be removed or renamed.
+type MountFS struct {
+	mu     sync.RWMutex
+	mounts map[string]FS
+}
+
+// NewMountFS returns a MountFS with root mounted at "/".
+func NewMountFS(root FS) *MountFS {
+	return &MountFS{
+		mounts: map[string]FS{"/": root},
+	}
+}
+
+// Mount mounts fs at the directory dir, replacing what is mounted there, if
+// anything. The directory and its missing parents are created in the
+// filesystem fs covers.
+func (m *MountFS) Mount(dir string, fs FS) error {
+	dir = cleanPath(dir)
+
+	if dir != "/" {
+		if err := mkdirAll(m, dir, 0755); err != nil {
+			return &os.PathError{Op: "mount", Path: dir, Err: err}
+		}
+	}
+
+	m.mu.Lock()
+	m.mounts[dir] = fs
+	m.mu.Unlock()
+
+	return nil
+}
+
+// lookup returns the FS serving name, the name within it and the directory
+// it is mounted at. Relative names are taken from the root.
+func (m *MountFS) lookup(name string) (FS, string, string) {
+	name = cleanPath(name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for dir := name; ; dir = path.Dir(dir) {
+		if fs, ok := m.mounts[dir]; ok {
+			return fs, cleanPath(strings.TrimPrefix(name, dir)), dir
+		}
+	}
+}
+
+// busy reports whether name is a mount point or holds one.
+func (m *MountFS) busy(name string) bool {
+	name = cleanPath(name)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for dir := range m.mounts {
+		if dir != "/" && (dir == name || strings.HasPrefix(dir, name+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve returns name with the symbolic links it goes through replaced by
+// their targets, except for the last element of name when follow is false.
+// Links are resolved here rather than by the filesystems holding them, so
+// that they can lead to other filesystems.
+func (m *MountFS) resolve(name string, follow bool) (string, error) {
+	lstat := func(name string) (os.FileInfo, error) {
+		fs, rel, _ := m.lookup(name)
+		return fs.Lstat(rel)
+	}
+
+	return resolveLinks(cleanPath(name), follow, lstat, m.readlink)
+}
+
+// find resolves name and returns the FS serving it and the name within it.
+func (m *MountFS) find(name string, follow bool) (FS, string, error) {
+	name, err := m.resolve(name, follow)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fs, rel, _ := m.lookup(name)
+	return fs, rel, nil
+}
+
+// lookup2 resolves oldname and newname, without following them, and returns
+// the FS serving both and their names within it, or EXDEV if they are on
+// different filesystems.
+func (m *MountFS) lookup2(oldname, newname string) (FS, string, string, error) {
+	oldname, err := m.resolve(oldname, false)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if newname, err = m.resolve(newname, false); err != nil {
+		return nil, "", "", err
+	}
+
+	fs, oldrel, olddir := m.lookup(oldname)
+	_, newrel, newdir := m.lookup(newname)
+	if olddir != newdir {
+		return nil, "", "", errno("EXDEV")
+	}
+
+	return fs, oldrel, newrel, nil
+}
+
+// OpenFile implements FS.
+func (m *MountFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	// O_EXCL fails on a symbolic link, even a dangling one.
+	fs, rel, err := m.find(name, flag&os.O_EXCL == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.OpenFile(rel, flag, perm)
+}
+
+// Stat implements FS.
+func (m *MountFS) Stat(name string) (os.FileInfo, error) {
+	fs, rel, err := m.find(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Stat(rel)
+}
+
+// Lstat implements FS.
+func (m *MountFS) Lstat(name string) (os.FileInfo, error) {
+	fs, rel, err := m.find(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return fs.Lstat(rel)
+}
+
+// ReadDir implements FS. The mount points in the directory are listed even
+// if the filesystem holding them lost them.
+func (m *MountFS) ReadDir(name string) ([]string, error) {
+	name, err := m.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	fs, rel, _ := m.lookup(name)
+	names, err := fs.ReadDir(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, n := range names {
+		seen[n] = true
+	}
+
+	m.mu.RLock()
+	for dir := range m.mounts {
+		if dir != "/" && path.Dir(dir) == name && !seen[path.Base(dir)] {
+			names = append(names, path.Base(dir))
+		}
+	}
+	m.mu.RUnlock()
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Mkdir implements FS.
+func (m *MountFS) Mkdir(name string, perm os.FileMode) error {
+	fs, rel, err := m.find(name, false)
+	if err != nil {
+		return err
+	}
+
+	return fs.Mkdir(rel, perm)
+}
+
+// Unlink implements FS.
+func (m *MountFS) Unlink(name string) error {
+	fs, rel, err := m.find(name, false)
+	if err != nil {
+		return err
+	}
+
+	return fs.Unlink(rel)
+}
+
+// Rmdir implements FS.
+func (m *MountFS) Rmdir(name string) error {
+	name, err := m.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	if m.busy(name) {
+		return errno("EBUSY")
+	}
+
+	fs, rel, _ := m.lookup(name)
+	return fs.Rmdir(rel)
+}
+
+// Rename implements FS.
+func (m *MountFS) Rename(oldname, newname string) error {
+	oldname, err := m.resolve(oldname, false)
+	if err != nil {
+		return err
+	}
+	if newname, err = m.resolve(newname, false); err != nil {
+		return err
+	}
+	if m.busy(oldname) || m.busy(newname) {
+		return errno("EBUSY")
+	}
+
+	fs, oldrel, newrel, err := m.lookup2(oldname, newname)
+	if err != nil {
+		return err
+	}
+
+	return fs.Rename(oldrel, newrel)
+}
+
+// Truncate implements FS.
+func (m *MountFS) Truncate(name string, size int64) error {
+	fs, rel, err := m.find(name, true)
+	if err != nil {
+		return err
+	}
+
+	return fs.Truncate(rel, size)
+}
+
+// Chmod implements FS.
+func (m *MountFS) Chmod(name string, mode os.FileMode) error {
+	fs, rel, err := m.find(name, true)
+	if err != nil {
+		return err
+	}
+
+	return fs.Chmod(rel, mode)
+}
+
+// Chown implements FS.
+func (m *MountFS) Chown(name string, uid, gid int) error {
+	fs, rel, err := m.find(name, true)
+	if err != nil {
+		return err
+	}
+
+	return fs.Chown(rel, uid, gid)
+}
+
+// Lchown implements FS.
+func (m *MountFS) Lchown(name string, uid, gid int) error {
+	fs, rel, err := m.find(name, false)
+	if err != nil {
+		return err
+	}
+
+	return fs.Lchown(rel, uid, gid)
+}
+
+// Chtimes implements FS.
+func (m *MountFS) Chtimes(name string, atime, mtime time.Time) error {
+	fs, rel, err := m.find(name, true)
+	if err != nil {
+		return err
+	}
+
+	return fs.Chtimes(rel, atime, mtime)
+}
+
+// Link implements FS.
+func (m *MountFS) Link(oldname, newname string) error {
+	fs, oldrel, newrel, err := m.lookup2(oldname, newname)
+	if err != nil {
+		return err
+	}
+
+	return fs.Link(oldrel, newrel)
+}
+
+// Symlink implements FS. An absolute target is a name of the MountFS; the
+// filesystem holding the link gets it relative to its mount point, or as a
+// relative target when it lies on another filesystem.
+func (m *MountFS) Symlink(oldname, newname string) error {
+	newname, err := m.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+
+	fs, rel, dir := m.lookup(newname)
+	if path.IsAbs(oldname) && dir != "/" {
+		if target := path.Clean(oldname); target == dir || strings.HasPrefix(target, dir+"/") {
+			oldname = cleanPath(strings.TrimPrefix(target, dir))
+		} else {
+			oldname = relativePath(path.Dir(newname), target)
+		}
+	}
+
+	return fs.Symlink(oldname, rel)
+}
+
+// Readlink implements FS.
+func (m *MountFS) Readlink(name string) (string, error) {
+	name, err := m.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+
+	return m.readlink(name)
+}
+
+// readlink reads the resolved link name, returning an absolute target as a
+// name of the MountFS.
+func (m *MountFS) readlink(name string) (string, error) {
+	fs, rel, dir := m.lookup(name)
+	target, err := fs.Readlink(rel)
+	if err != nil || !path.IsAbs(target) {
+		return target, err
+	}
+
+	return path.Join(dir, target), nil
+}
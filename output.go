@@ -0,0 +1,130 @@
+package wasmvm
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// OutputFormat is how instances write their standard output and error.
+type OutputFormat int
+
+const (
+	// OutputRaw writes what the guest writes, byte for byte.
+	OutputRaw OutputFormat = iota
+	// OutputPrefixed starts each line with the ID of the instance in
+	// brackets, so the output of several instances can be told apart. A last
+	// line without a newline gets one.
+	OutputPrefixed
+	// OutputJSON writes each line as a JSON object with the time, the ID of
+	// the instance, the stream and the line, including its newline. Lines
+	// that are not valid UTF-8 are given in base64 instead of as text, so the
+	// output of the guest can be put back together exactly.
+	OutputJSON
+)
+
+// stdWriter writes to the standard output, fd 1, or error, fd 2, of inst,
+// whatever writer is set for it at the time.
+type stdWriter struct {
+	inst *Instance
+	fd   int
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	if w.fd == 2 {
+		return w.inst.stderr.Write(p)
+	}
+	return w.inst.stdout.Write(p)
+}
+
+// lineWriter hands each complete line written to it to emit, keeping the
+// last line until its newline comes or it is flushed.
+type lineWriter struct {
+	buf  []byte
+	emit func(line []byte) error
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.buf[:i+1]
+		w.buf = w.buf[i+1:]
+		if err := w.emit(line); err != nil {
+			return len(p), err
+		}
+	}
+
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+
+	return len(p), nil
+}
+
+// Flush emits the last line, if it did not end with a newline.
+func (w *lineWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	line := w.buf
+	w.buf = nil
+	return w.emit(line)
+}
+
+// formatOutput returns w writing in the format f, for the stream named
+// stream of the instance with the given ID, and a function writing what is
+// left once the instance is done. JSON lines are stamped with the time on
+// clock.
+func formatOutput(f OutputFormat, w io.Writer, id, stream string, clock Clock) (io.Writer, func() error) {
+	var emit func(line []byte) error
+
+	switch f {
+	case OutputPrefixed:
+		emit = func(line []byte) error {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			_, err := fmt.Fprintf(w, "[%s] %s", id, line)
+			return err
+		}
+	case OutputJSON:
+		emit = func(line []byte) error {
+			entry := struct {
+				Time     time.Time `json:"time"`
+				Instance string    `json:"instance"`
+				Stream   string    `json:"stream"`
+				Text     *string   `json:"text,omitempty"`
+				Base64   *string   `json:"base64,omitempty"`
+			}{Time: clock.Now(), Instance: id, Stream: stream}
+
+			if s := string(line); utf8.ValidString(s) {
+				entry.Text = &s
+			} else {
+				s = base64.StdEncoding.EncodeToString(line)
+				entry.Base64 = &s
+			}
+
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(data, '\n'))
+			return err
+		}
+	default:
+		return w, func() error { return nil }
+	}
+
+	lw := &lineWriter{emit: emit}
+	return lw, lw.Flush
+}
@@ -0,0 +1,139 @@
+package wasmvm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/output/main.wasm ./testdata/output
+
+// runOutput runs testdata/output with args, returning what it wrote to its
+// standard output and error.
+func runOutput(t *testing.T, opts Options, args ...string) (stdout, stderr []byte) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	opts.Stdout, opts.Stderr = &out, &errOut
+
+	inst := loadWasm(t, NewRuntime(opts), "testdata/output/main.wasm")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := inst.Run(ctx, append([]string{"output"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+
+	return out.Bytes(), errOut.Bytes()
+}
+
+func TestOutputRaw(t *testing.T) {
+	stdout, stderr := runOutput(t, Options{})
+
+	want := make([]byte, 256)
+	for i := range want {
+		want[i] = byte(i)
+	}
+	want = append(want, "no newline"...)
+	if !bytes.Equal(stdout, want) {
+		t.Errorf("stdout:\ngot:  %q\nwant: %q", stdout, want)
+	}
+
+	if want := "to stderr\nfrom the runtime\n"; string(stderr) != want {
+		t.Errorf("stderr:\ngot:  %q\nwant: %q", stderr, want)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var shared, own bytes.Buffer
+	rt := NewRuntime(Options{Stdout: &shared, Stderr: &shared})
+
+	a := loadWasm(t, rt, "testdata/output/main.wasm")
+	b := loadWasm(t, rt, "testdata/output/main.wasm")
+	b.SetOutput(&own, nil)
+	if a.ID() == b.ID() {
+		t.Fatalf("instances share the ID %q", a.ID())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, inst := range []*Instance{a, b} {
+		if err := inst.Run(ctx, []string{"output", "lines"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := "one\ntwo\nwarning\n\xff\xfe\nlast without newline" + "warning\n"; shared.String() != want {
+		t.Errorf("shared:\ngot:  %q\nwant: %q", shared.String(), want)
+	}
+	if want := "one\ntwo\n\xff\xfe\nlast without newline"; own.String() != want {
+		t.Errorf("own:\ngot:  %q\nwant: %q", own.String(), want)
+	}
+}
+
+func TestOutputPrefixed(t *testing.T) {
+	stdout, stderr := runOutput(t, Options{OutputFormat: OutputPrefixed}, "lines")
+
+	if want := "[1] one\n[1] two\n[1] \xff\xfe\n[1] last without newline\n"; string(stdout) != want {
+		t.Errorf("stdout:\ngot:  %q\nwant: %q", stdout, want)
+	}
+	if want := "[1] warning\n"; string(stderr) != want {
+		t.Errorf("stderr:\ngot:  %q\nwant: %q", stderr, want)
+	}
+}
+
+func TestOutputJSON(t *testing.T) {
+	start := time.Now()
+	stdout, _ := runOutput(t, Options{OutputFormat: OutputJSON}, "lines")
+
+	type entry struct {
+		Time     time.Time
+		Instance string
+		Stream   string
+		Text     string
+		Base64   []byte
+	}
+	want := []entry{
+		{Instance: "1", Stream: "stdout", Text: "one\n"},
+		{Instance: "1", Stream: "stdout", Text: "two\n"},
+		{Instance: "1", Stream: "stdout", Base64: []byte("\xff\xfe\n")},
+		{Instance: "1", Stream: "stdout", Text: "last without newline"},
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(stdout), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), stdout)
+	}
+	for i, line := range lines {
+		var got entry
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if got.Time.Before(start) || got.Time.After(time.Now()) {
+			t.Errorf("line %d: time %v out of the run", i+1, got.Time)
+		}
+		got.Time = time.Time{}
+		if got.Instance != want[i].Instance || got.Stream != want[i].Stream || got.Text != want[i].Text || !bytes.Equal(got.Base64, want[i].Base64) {
+			t.Errorf("line %d:\ngot:  %+v\nwant: %+v", i+1, got, want[i])
+		}
+	}
+}
+
+// JSON lines are stamped with the time of the instance.
+func TestOutputJSONClock(t *testing.T) {
+	start := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	stdout, _ := runOutput(t, Options{OutputFormat: OutputJSON, Clock: NewVirtualClock(start)}, "lines")
+
+	for i, line := range strings.Split(strings.TrimSuffix(string(stdout), "\n"), "\n") {
+		var got struct{ Time time.Time }
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if !got.Time.Equal(start) {
+			t.Errorf("line %d: time %v, want %v", i+1, got.Time, start)
+		}
+	}
+}
@@ -0,0 +1,735 @@
+package wasmvm
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OverlayFS puts a writable upper layer on top of a lower FS that it never
+// changes, like the overlay filesystem Docker uses. Files are copied up to
+// the upper layer the first time they change. Removing a file of the lower
+// layer leaves a whiteout hiding it, and a directory created where one was
+// removed is opaque: the lower directory does not show through it.
+//
+// Directories of the lower layer cannot be renamed, and fail with EXDEV as
+// they do on Linux.
+type OverlayFS struct {
+	mu    sync.Mutex
+	lower FS
+	upper FS
+
+	whiteouts map[string]bool
+	opaque    map[string]bool
+}
+
+// NewOverlayFS returns an overlay of lower. If upper is nil, changes are kept
+// in a MemFS.
+func NewOverlayFS(lower, upper FS) *OverlayFS {
+	if upper == nil {
+		upper = NewMemFS()
+	}
+
+	return &OverlayFS{
+		lower:     lower,
+		upper:     upper,
+		whiteouts: map[string]bool{},
+		opaque:    map[string]bool{},
+	}
+}
+
+// Upper returns the upper layer.
+func (o *OverlayFS) Upper() FS {
+	return o.upper
+}
+
+// Discard drops the changes made to the overlay, emptying the upper layer.
+func (o *OverlayFS) Discard() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	names, err := o.upper.ReadDir("/")
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := removeAll(o.upper, "/"+name); err != nil {
+			return err
+		}
+	}
+
+	o.whiteouts = map[string]bool{}
+	o.opaque = map[string]bool{}
+
+	return nil
+}
+
+// Export writes the upper layer to w as a tar archive in the layout of OCI
+// image layers: a whiteout is an empty file named .wh.<name>, and an opaque
+// directory holds an empty file named .wh..wh..opq.
+func (o *OverlayFS) Export(w io.Writer) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	tw := tar.NewWriter(w)
+	if err := o.export(tw, "/"); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+func (o *OverlayFS) export(tw *tar.Writer, dir string) error {
+	names, err := o.upper.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	marks := map[string]bool{}
+	if o.opaque[dir] {
+		marks[".wh..wh..opq"] = true
+	}
+	for name := range o.whiteouts {
+		if name != "/" && path.Dir(name) == dir {
+			marks[".wh."+path.Base(name)] = true
+		}
+	}
+	for mark := range marks {
+		names = append(names, mark)
+	}
+	sort.Strings(names)
+
+	for _, base := range names {
+		name := path.Join(dir, base)
+		if marks[base] {
+			hdr := &tar.Header{Name: name[1:], Typeflag: tar.TypeReg, Mode: 0644, ModTime: time.Now()}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fi, err := o.upper.Lstat(name)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name[1:]
+		if st, ok := fi.Sys().(*FileStat); ok {
+			hdr.Uid, hdr.Gid = st.UID, st.GID
+		}
+
+		switch {
+		case fi.IsDir():
+			hdr.Name += "/"
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if err := o.export(tw, name); err != nil {
+				return err
+			}
+		case fi.Mode()&os.ModeSymlink != 0:
+			if hdr.Linkname, err = o.upper.Readlink(name); err != nil {
+				return err
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+		default:
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if err := copyFileTo(tw, o.upper, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// lowerVisible reports whether name in the lower layer shows through the
+// whiteouts and opaque directories.
+func (o *OverlayFS) lowerVisible(name string) bool {
+	for p := name; ; p = path.Dir(p) {
+		if o.whiteouts[p] || (p != name && o.opaque[p]) {
+			return false
+		}
+		if p == "/" {
+			return true
+		}
+	}
+}
+
+// lowerHas reports whether name exists in the lower layer and shows through.
+func (o *OverlayFS) lowerHas(name string) bool {
+	if !o.lowerVisible(name) {
+		return false
+	}
+
+	_, err := o.lower.Lstat(name)
+	return err == nil
+}
+
+// lstat describes name as the overlay shows it, without following it if it
+// is a symbolic link, and reports whether it comes from the upper layer.
+func (o *OverlayFS) lstat(name string) (os.FileInfo, bool, error) {
+	fi, err := o.upper.Lstat(name)
+	if err == nil || fsError(err).Code != "ENOENT" {
+		return fi, err == nil, err
+	}
+	if !o.lowerVisible(name) {
+		return nil, false, errno("ENOENT")
+	}
+
+	fi, err = o.lower.Lstat(name)
+	return fi, false, err
+}
+
+// resolve returns name with the symbolic links it goes through replaced by
+// their targets, except for the last element of name when follow is false.
+// The links are resolved against the whole overlay, as each layer only sees
+// the files it holds.
+func (o *OverlayFS) resolve(name string, follow bool) (string, error) {
+	lstat := func(name string) (os.FileInfo, error) {
+		fi, _, err := o.lstat(name)
+		return fi, err
+	}
+
+	return resolveLinks(name, follow, lstat, o.readlink)
+}
+
+// readlink reads the link name, which must be resolved, from the layer
+// showing it.
+func (o *OverlayFS) readlink(name string) (string, error) {
+	_, inUpper, err := o.lstat(name)
+	if err != nil {
+		return "", err
+	}
+	if inUpper {
+		return o.upper.Readlink(name)
+	}
+
+	return o.lower.Readlink(name)
+}
+
+// copyUp copies name from the lower layer to the upper one, with its
+// parents, unless it is there already.
+func (o *OverlayFS) copyUp(name string) error {
+	if _, err := o.upper.Lstat(name); err == nil {
+		return nil
+	}
+	if name != "/" {
+		if err := o.copyUp(path.Dir(name)); err != nil {
+			return err
+		}
+	}
+
+	fi, err := o.lower.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case fi.IsDir():
+		err = o.upper.Mkdir(name, fi.Mode().Perm())
+	case fi.Mode()&os.ModeSymlink != 0:
+		var target string
+		if target, err = o.lower.Readlink(name); err == nil {
+			err = o.upper.Symlink(target, name)
+		}
+	default:
+		err = o.copyFile(name, fi)
+	}
+	if err != nil {
+		return err
+	}
+
+	// An upper layer on the host may not be allowed to keep the owner.
+	if st, ok := fi.Sys().(*FileStat); ok {
+		if err := o.upper.Lchown(name, st.UID, st.GID); err != nil && fsError(err).Code != "EPERM" {
+			return err
+		}
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if err := o.upper.Chmod(name, fi.Mode()); err != nil {
+		return err
+	}
+
+	atime := fi.ModTime()
+	if st, ok := fi.Sys().(*FileStat); ok && !st.Atime.IsZero() {
+		atime = st.Atime
+	}
+	return o.upper.Chtimes(name, atime, fi.ModTime())
+}
+
+// copyFile copies the contents of the lower file name to the upper layer.
+func (o *OverlayFS) copyFile(name string, fi os.FileInfo) error {
+	f, err := o.lower.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return writeFile(o.upper, name, io.NewSectionReader(f, 0, fi.Size()))
+}
+
+// prepare copies up the parents of name, if they are in the lower layer, so
+// that name can be created in the upper one.
+func (o *OverlayFS) prepare(name string) error {
+	dir := path.Dir(name)
+	if _, err := o.upper.Lstat(dir); err == nil || !o.lowerHas(dir) {
+		return nil
+	}
+
+	return o.copyUp(dir)
+}
+
+// OpenFile implements FS.
+func (o *OverlayFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	write := writable(flag) || flag&os.O_TRUNC != 0
+
+	// O_EXCL fails on a symbolic link, even a dangling one.
+	name, err := o.resolve(name, flag&os.O_EXCL == 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, inUpper, err := o.lstat(name)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, errno("EEXIST")
+	case err == nil && fi.IsDir() && write:
+		return nil, errno("EISDIR")
+	case err == nil && !inUpper && !write:
+		return o.lower.OpenFile(name, flag&^os.O_CREATE, perm)
+	case err == nil && !inUpper:
+		if err := o.copyUp(name); err != nil {
+			return nil, err
+		}
+	case err == nil:
+	case fsError(err).Code == "ENOENT" && flag&os.O_CREATE != 0:
+		if err := o.prepare(name); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	f, err := o.upper.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	delete(o.whiteouts, name)
+
+	return f, nil
+}
+
+// Stat implements FS.
+func (o *OverlayFS) Stat(name string) (os.FileInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, _, err := o.lstat(name)
+	return fi, err
+}
+
+// Lstat implements FS.
+func (o *OverlayFS) Lstat(name string) (os.FileInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, _, err := o.lstat(name)
+	return fi, err
+}
+
+// ReadDir implements FS.
+func (o *OverlayFS) ReadDir(name string) ([]string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.readDir(name)
+}
+
+// readDir lists the directory name, which must be resolved.
+func (o *OverlayFS) readDir(name string) ([]string, error) {
+	fi, inUpper, err := o.lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, errno("ENOTDIR")
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	if inUpper {
+		if names, err = o.upper.ReadDir(name); err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			seen[n] = true
+		}
+	}
+
+	if o.lowerVisible(name) && !o.opaque[name] {
+		lower, err := o.lower.ReadDir(name)
+		if err != nil && inUpper {
+			lower = nil
+		} else if err != nil {
+			return nil, err
+		}
+		for _, n := range lower {
+			if !seen[n] && !o.whiteouts[path.Join(name, n)] {
+				names = append(names, n)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Mkdir implements FS.
+func (o *OverlayFS) Mkdir(name string, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, false)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := o.lstat(name); err == nil {
+		return errno("EEXIST")
+	}
+	if err := o.prepare(name); err != nil {
+		return err
+	}
+	if err := o.upper.Mkdir(name, perm); err != nil {
+		return err
+	}
+
+	if o.whiteouts[name] {
+		delete(o.whiteouts, name)
+		o.opaque[name] = true
+	}
+
+	return nil
+}
+
+// Unlink implements FS.
+func (o *OverlayFS) Unlink(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, false)
+	if err != nil {
+		return err
+	}
+
+	fi, inUpper, err := o.lstat(name)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errno("EISDIR")
+	}
+
+	return o.remove(name, inUpper)
+}
+
+// Rmdir implements FS.
+func (o *OverlayFS) Rmdir(name string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	if name == "/" {
+		return errno("EBUSY")
+	}
+
+	fi, inUpper, err := o.lstat(name)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errno("ENOTDIR")
+	}
+	if names, err := o.readDir(name); err != nil {
+		return err
+	} else if len(names) > 0 {
+		return errno("ENOTEMPTY")
+	}
+
+	if err := o.remove(name, inUpper); err != nil {
+		return err
+	}
+	o.forget(name)
+
+	return nil
+}
+
+// remove removes name from the upper layer, if it is there, and hides it in
+// the lower one.
+func (o *OverlayFS) remove(name string, inUpper bool) error {
+	lower := o.lowerHas(name)
+
+	if inUpper {
+		var err error
+		if fi, _ := o.upper.Lstat(name); fi != nil && fi.IsDir() {
+			err = o.upper.Rmdir(name)
+		} else {
+			err = o.upper.Unlink(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if lower {
+		// The whiteout goes in the upper directory, which must exist for
+		// Export.
+		if err := o.prepare(name); err != nil {
+			return err
+		}
+		o.whiteouts[name] = true
+	}
+
+	return nil
+}
+
+// forget drops the whiteouts and opaque marks inside the directory dir.
+func (o *OverlayFS) forget(dir string) {
+	delete(o.opaque, dir)
+	for _, marks := range []map[string]bool{o.whiteouts, o.opaque} {
+		for name := range marks {
+			if strings.HasPrefix(name, dir+"/") {
+				delete(marks, name)
+			}
+		}
+	}
+}
+
+// Rename implements FS.
+func (o *OverlayFS) Rename(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	oldname, err := o.resolve(oldname, false)
+	if err != nil {
+		return err
+	}
+	if newname, err = o.resolve(newname, false); err != nil {
+		return err
+	}
+	if oldname == "/" || newname == "/" {
+		return errno("EBUSY")
+	}
+
+	fi, _, err := o.lstat(oldname)
+	if err != nil {
+		return err
+	}
+	if oldname == newname {
+		return nil
+	}
+	if fi.IsDir() && o.lowerHas(oldname) {
+		return errno("EXDEV")
+	}
+	if fi.IsDir() && strings.HasPrefix(newname, oldname+"/") {
+		return errno("EINVAL")
+	}
+
+	target, _, err := o.lstat(newname)
+	switch {
+	case err == nil && fi.IsDir() && !target.IsDir():
+		return errno("ENOTDIR")
+	case err == nil && !fi.IsDir() && target.IsDir():
+		return errno("EISDIR")
+	case err == nil && target.IsDir():
+		if names, err := o.readDir(newname); err != nil {
+			return err
+		} else if len(names) > 0 {
+			return errno("ENOTEMPTY")
+		}
+	}
+	replacesLowerDir := err == nil && target.IsDir() && o.lowerHas(newname)
+
+	if err := o.copyUp(oldname); err != nil {
+		return err
+	}
+	if err := o.prepare(newname); err != nil {
+		return err
+	}
+	lower := o.lowerHas(oldname)
+	if err := o.upper.Rename(oldname, newname); err != nil {
+		return err
+	}
+
+	delete(o.whiteouts, newname)
+	o.forget(newname)
+	for _, marks := range []map[string]bool{o.whiteouts, o.opaque} {
+		for name := range marks {
+			if strings.HasPrefix(name, oldname+"/") {
+				delete(marks, name)
+				marks[newname+strings.TrimPrefix(name, oldname)] = true
+			}
+		}
+	}
+	if o.opaque[oldname] || replacesLowerDir {
+		o.opaque[newname] = true
+	}
+	delete(o.opaque, oldname)
+	if lower {
+		o.whiteouts[oldname] = true
+	}
+
+	return nil
+}
+
+// change copies name up and applies f to its resolved name in the upper
+// layer.
+func (o *OverlayFS) change(name string, follow bool, f func(name string) error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, follow)
+	if err != nil {
+		return err
+	}
+
+	_, inUpper, err := o.lstat(name)
+	if err != nil {
+		return err
+	}
+	if !inUpper {
+		if err := o.copyUp(name); err != nil {
+			return err
+		}
+	}
+
+	return f(name)
+}
+
+// Truncate implements FS.
+func (o *OverlayFS) Truncate(name string, size int64) error {
+	return o.change(name, true, func(name string) error { return o.upper.Truncate(name, size) })
+}
+
+// Chmod implements FS.
+func (o *OverlayFS) Chmod(name string, mode os.FileMode) error {
+	return o.change(name, true, func(name string) error { return o.upper.Chmod(name, mode) })
+}
+
+// Chown implements FS.
+func (o *OverlayFS) Chown(name string, uid, gid int) error {
+	return o.change(name, true, func(name string) error { return o.upper.Chown(name, uid, gid) })
+}
+
+// Lchown implements FS.
+func (o *OverlayFS) Lchown(name string, uid, gid int) error {
+	return o.change(name, false, func(name string) error { return o.upper.Lchown(name, uid, gid) })
+}
+
+// Chtimes implements FS.
+func (o *OverlayFS) Chtimes(name string, atime, mtime time.Time) error {
+	return o.change(name, true, func(name string) error { return o.upper.Chtimes(name, atime, mtime) })
+}
+
+// Link implements FS.
+func (o *OverlayFS) Link(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	oldname, err := o.resolve(oldname, false)
+	if err != nil {
+		return err
+	}
+	if newname, err = o.resolve(newname, false); err != nil {
+		return err
+	}
+
+	if _, _, err := o.lstat(newname); err == nil {
+		return errno("EEXIST")
+	}
+	if err := o.copyUp(oldname); err != nil {
+		return err
+	}
+	if err := o.prepare(newname); err != nil {
+		return err
+	}
+	if err := o.upper.Link(oldname, newname); err != nil {
+		return err
+	}
+	delete(o.whiteouts, newname)
+
+	return nil
+}
+
+// Symlink implements FS.
+func (o *OverlayFS) Symlink(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	newname, err := o.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := o.lstat(newname); err == nil {
+		return errno("EEXIST")
+	}
+	if err := o.prepare(newname); err != nil {
+		return err
+	}
+	if err := o.upper.Symlink(oldname, newname); err != nil {
+		return err
+	}
+	delete(o.whiteouts, newname)
+
+	return nil
+}
+
+// Readlink implements FS.
+func (o *OverlayFS) Readlink(name string) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	name, err := o.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+
+	return o.readlink(name)
+}
@@ -0,0 +1,238 @@
+package wasmvm
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// lowerLayer returns a read-only FS with a few files for overlays to cover.
+func lowerLayer(t *testing.T) FS {
+	t.Helper()
+
+	fs := NewMemFS()
+	for _, dir := range []string{"/etc", "/etc/conf.d", "/var"} {
+		if err := fs.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, data := range map[string]string{
+		"/etc/hosts":         "127.0.0.1 localhost\n",
+		"/etc/conf.d/a.conf": "a\n",
+		"/etc/conf.d/b.conf": "b\n",
+		"/var/log":           "old log\n",
+	} {
+		if err := writeFile(fs, name, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewReadOnlyFS(fs)
+}
+
+func readAll(t *testing.T, fs FS, name string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := copyFileTo(&buf, fs, name); err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return buf.String()
+}
+
+func TestOverlayFS(t *testing.T) {
+	lower := lowerLayer(t)
+	o := NewOverlayFS(lower, nil)
+
+	f, err := o.OpenFile("/etc/hosts", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("10.0.0.1 db\n"), 20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if got := readAll(t, o, "/etc/hosts"); got != "127.0.0.1 localhost\n10.0.0.1 db\n" {
+		t.Errorf("overlay hosts: %q", got)
+	}
+	if got := readAll(t, lower, "/etc/hosts"); got != "127.0.0.1 localhost\n" {
+		t.Errorf("lower layer changed: %q", got)
+	}
+
+	if err := o.Unlink("/etc/conf.d/a.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Stat("/etc/conf.d/a.conf"); fsError(err).Code != "ENOENT" {
+		t.Errorf("whiteout: %v", err)
+	}
+	if names, _ := o.ReadDir("/etc/conf.d"); strings.Join(names, ",") != "b.conf" {
+		t.Errorf("readdir after whiteout: %v", names)
+	}
+
+	// A directory recreated where one was removed does not show the old
+	// contents.
+	if err := o.Rmdir("/etc/conf.d"); fsError(err).Code != "ENOTEMPTY" {
+		t.Errorf("rmdir not empty: %v", err)
+	}
+	if err := o.Unlink("/etc/conf.d/b.conf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Rmdir("/etc/conf.d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Mkdir("/etc/conf.d", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := o.ReadDir("/etc/conf.d"); len(names) != 0 {
+		t.Errorf("opaque directory shows %v", names)
+	}
+
+	if err := o.Rename("/var/log", "/var/log.1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, o, "/var/log.1"); got != "old log\n" {
+		t.Errorf("renamed file: %q", got)
+	}
+	if err := o.Rename("/etc", "/etc2"); fsError(err).Code != "EXDEV" {
+		t.Errorf("rename lower directory: %v", err)
+	}
+	if err := o.Chmod("/etc", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := lower.Stat("/etc"); fi.Mode().Perm() != 0755 {
+		t.Errorf("lower directory mode changed to %v", fi.Mode())
+	}
+
+	var layer bytes.Buffer
+	if err := o.Export(&layer); err != nil {
+		t.Fatal(err)
+	}
+	var entries []string
+	tr := tar.NewReader(&layer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, hdr.Name)
+	}
+	sort.Strings(entries)
+	want := []string{
+		"etc/",
+		"etc/conf.d/",
+		"etc/conf.d/.wh..wh..opq",
+		"etc/hosts",
+		"var/",
+		"var/.wh.log",
+		"var/log.1",
+	}
+	if strings.Join(entries, " ") != strings.Join(want, " ") {
+		t.Errorf("exported layer:\n%s\nwant:\n%s", strings.Join(entries, "\n"), strings.Join(want, "\n"))
+	}
+
+	if err := o.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, o, "/etc/hosts"); got != "127.0.0.1 localhost\n" {
+		t.Errorf("hosts after discard: %q", got)
+	}
+	if names, _ := o.ReadDir("/etc/conf.d"); strings.Join(names, ",") != "a.conf,b.conf" {
+		t.Errorf("readdir after discard: %v", names)
+	}
+}
+
+// Symbolic links of either layer lead to the files of both.
+func TestOverlayFSSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "dir", "old"), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lower, err := NewHostFS(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lower.Symlink("/dir", "/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	upper, err := NewHostFS(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewOverlayFS(NewReadOnlyFS(lower), upper)
+	if err := writeFile(o, "/dir/new", strings.NewReader("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Mkdir("/up", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Symlink("../link", "/up/link"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/link/new", "/link/old", "/up/link/new", "/up/link/old"} {
+		if got := readAll(t, o, name); got != path.Base(name)+"\n" {
+			t.Errorf("read %s: %q", name, got)
+		}
+	}
+	if names, err := o.ReadDir("/up/link"); err != nil || strings.Join(names, ",") != "new,old" {
+		t.Errorf("readdir /up/link: %v, %v", names, err)
+	}
+
+	if err := writeFile(o, "/link/other", strings.NewReader("other\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, o, "/dir/other"); got != "other\n" {
+		t.Errorf("write through link: %q", got)
+	}
+	if err := o.Unlink("/link/old"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Stat("/dir/old"); fsError(err).Code != "ENOENT" {
+		t.Errorf("unlink through link: %v", err)
+	}
+	if fi, err := o.Lstat("/up/link"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("lstat /up/link: %v, %v", fi, err)
+	}
+}
+
+// An overlay behaves like any other writable filesystem to the guest.
+func TestOverlayFSConformance(t *testing.T) {
+	for _, program := range []string{"fs", "links"} {
+		dir := filepath.Join("testdata", program)
+		want, err := ioutil.ReadFile(filepath.Join(dir, "want.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, lower := range map[string]FS{
+			"empty":  NewReadOnlyFS(NewMemFS()),
+			"filled": lowerLayer(t),
+		} {
+			t.Run(program+"/"+name, func(t *testing.T) {
+				o := NewOverlayFS(lower, nil)
+				got := runLogged(t, filepath.Join(dir, "main.wasm"), func(inst *Instance) {
+					inst.global["fs"] = newFSImport(inst, o)
+				})
+				if got != string(want) {
+					t.Errorf("got:\n%s", got)
+				}
+			})
+		}
+	}
+}
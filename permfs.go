@@ -0,0 +1,400 @@
+package wasmvm
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Identity is the user a guest runs as. The fs module checks permissions for
+// it like a Unix kernel does, and the process module reports it. The zero
+// Identity is root with no umask, for which everything but running files
+// without execute bits is allowed.
+type Identity struct {
+	UID, GID int
+	// Groups are the supplementary groups.
+	Groups []int
+	// Umask clears permission bits of the files and directories the guest
+	// creates.
+	Umask os.FileMode
+}
+
+// inGroup reports whether gid is the group of id or one of its
+// supplementary groups.
+func (id *Identity) inGroup(gid int) bool {
+	if gid == id.GID {
+		return true
+	}
+	for _, g := range id.Groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// Access bits, as in the modes of files.
+const (
+	accessR = 4
+	accessW = 2
+	accessX = 1
+)
+
+// fileOwner returns the owner of fi. Files of filesystems that do not record
+// owners belong to root.
+func fileOwner(fi os.FileInfo) (uid, gid int) {
+	if st, ok := fi.Sys().(*FileStat); ok {
+		return st.UID, st.GID
+	}
+	return 0, 0
+}
+
+// access returns EACCES unless id has the access bits want to fi.
+func (id *Identity) access(fi os.FileInfo, want uint32) error {
+	perm := uint32(fi.Mode().Perm())
+
+	if id.UID == 0 {
+		// Root may run a file only if someone may.
+		if want&accessX == 0 || fi.IsDir() || perm&0111 != 0 {
+			return nil
+		}
+		return errno("EACCES")
+	}
+
+	uid, gid := fileOwner(fi)
+	switch {
+	case uid == id.UID:
+		perm >>= 6
+	case id.inGroup(gid):
+		perm >>= 3
+	}
+	if perm&want != want {
+		return errno("EACCES")
+	}
+
+	return nil
+}
+
+// owns returns EPERM unless id owns fi or is root.
+func (id *Identity) owns(fi os.FileInfo) error {
+	if uid, _ := fileOwner(fi); id.UID != 0 && uid != id.UID {
+		return errno("EPERM")
+	}
+	return nil
+}
+
+// canChown returns EPERM unless id may give fi to uid and gid, -1 keeping
+// the current value. Only root gives files away; owners may change the group
+// to one of theirs.
+func (id *Identity) canChown(fi os.FileInfo, uid, gid int) error {
+	if id.UID == 0 {
+		return nil
+	}
+
+	owner, group := fileOwner(fi)
+	if owner != id.UID || uid != -1 && uid != owner || gid != -1 && gid != group && !id.inGroup(gid) {
+		return errno("EPERM")
+	}
+
+	return nil
+}
+
+// permFS enforces the permissions of the files of fs for an identity, and
+// gives it the files it creates.
+type permFS struct {
+	fs FS
+	id *Identity
+}
+
+// search checks that every directory leading to name can be searched.
+// Missing directories, and files in their place, are left for the operation
+// to report.
+func (p *permFS) search(name string) error {
+	dir := "/"
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		dir = path.Join(dir, elem)
+
+		fi, err := p.fs.Stat(dir)
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		if err := p.id.access(fi, accessX); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check checks that name can be reached and accessed with want.
+func (p *permFS) check(name string, want uint32) error {
+	if err := p.search(name); err != nil {
+		return err
+	}
+
+	fi, err := p.fs.Stat(name)
+	if err != nil {
+		return nil
+	}
+
+	return p.id.access(fi, want)
+}
+
+// stat returns the file name, following symbolic links if follow is set,
+// once its directory can be searched.
+func (p *permFS) stat(name string, follow bool) (os.FileInfo, error) {
+	if err := p.search(name); err != nil {
+		return nil, err
+	}
+	if follow {
+		return p.fs.Stat(name)
+	}
+	return p.fs.Lstat(name)
+}
+
+// parent checks that entries can be added to or removed from the directory
+// of name. For removals, old is the entry going away: in a sticky directory
+// only its owner, or the owner of the directory, may remove it.
+func (p *permFS) parent(name string, old bool) error {
+	dir := path.Dir(name)
+	if err := p.check(dir, accessW|accessX); err != nil {
+		return err
+	}
+	if !old || p.id.UID == 0 {
+		return nil
+	}
+
+	dfi, err := p.fs.Stat(dir)
+	if err != nil || dfi.Mode()&os.ModeSticky == 0 {
+		return nil
+	}
+	fi, err := p.fs.Lstat(name)
+	if err != nil {
+		return nil
+	}
+	if duid, _ := fileOwner(dfi); duid != p.id.UID {
+		return p.id.owns(fi)
+	}
+
+	return nil
+}
+
+// own gives the file name that was just created to the identity. Filesystems
+// that cannot do it keep their owner.
+func (p *permFS) own(name string) {
+	p.fs.Lchown(name, p.id.UID, p.id.GID)
+}
+
+// OpenFile implements FS.
+func (p *permFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := p.search(name); err != nil {
+		return nil, err
+	}
+
+	created := false
+	if fi, err := p.fs.Stat(name); err == nil {
+		if flag&(os.O_CREATE|os.O_EXCL) != os.O_CREATE|os.O_EXCL {
+			var want uint32
+			if flag&(os.O_WRONLY|os.O_RDWR) != os.O_WRONLY {
+				want |= accessR
+			}
+			if writable(flag) || flag&os.O_TRUNC != 0 {
+				want |= accessW
+			}
+			if err := p.id.access(fi, want); err != nil {
+				return nil, err
+			}
+		}
+	} else if flag&os.O_CREATE != 0 {
+		if err := p.parent(name, false); err != nil {
+			return nil, err
+		}
+		perm &^= p.id.Umask
+		created = true
+	}
+
+	f, err := p.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		p.own(name)
+	}
+
+	return &permFile{File: f, id: p.id}, nil
+}
+
+// Stat implements FS.
+func (p *permFS) Stat(name string) (os.FileInfo, error) {
+	return p.stat(name, true)
+}
+
+// Lstat implements FS.
+func (p *permFS) Lstat(name string) (os.FileInfo, error) {
+	return p.stat(name, false)
+}
+
+// ReadDir implements FS.
+func (p *permFS) ReadDir(name string) ([]string, error) {
+	if err := p.check(name, accessR); err != nil {
+		return nil, err
+	}
+	return p.fs.ReadDir(name)
+}
+
+// Mkdir implements FS.
+func (p *permFS) Mkdir(name string, perm os.FileMode) error {
+	if err := p.parent(name, false); err != nil {
+		return err
+	}
+	if err := p.fs.Mkdir(name, perm&^p.id.Umask); err != nil {
+		return err
+	}
+
+	p.own(name)
+	return nil
+}
+
+// Unlink implements FS.
+func (p *permFS) Unlink(name string) error {
+	if err := p.parent(name, true); err != nil {
+		return err
+	}
+	return p.fs.Unlink(name)
+}
+
+// Rmdir implements FS.
+func (p *permFS) Rmdir(name string) error {
+	if err := p.parent(name, true); err != nil {
+		return err
+	}
+	return p.fs.Rmdir(name)
+}
+
+// Rename implements FS.
+func (p *permFS) Rename(oldname, newname string) error {
+	if err := p.parent(oldname, true); err != nil {
+		return err
+	}
+	if err := p.parent(newname, true); err != nil {
+		return err
+	}
+	return p.fs.Rename(oldname, newname)
+}
+
+// Truncate implements FS.
+func (p *permFS) Truncate(name string, size int64) error {
+	if err := p.check(name, accessW); err != nil {
+		return err
+	}
+	return p.fs.Truncate(name, size)
+}
+
+// Chmod implements FS.
+func (p *permFS) Chmod(name string, mode os.FileMode) error {
+	fi, err := p.stat(name, true)
+	if err != nil {
+		return err
+	}
+	if err := p.id.owns(fi); err != nil {
+		return err
+	}
+	return p.fs.Chmod(name, mode)
+}
+
+// Chown implements FS.
+func (p *permFS) Chown(name string, uid, gid int) error {
+	fi, err := p.stat(name, true)
+	if err != nil {
+		return err
+	}
+	if err := p.id.canChown(fi, uid, gid); err != nil {
+		return err
+	}
+	return p.fs.Chown(name, uid, gid)
+}
+
+// Lchown implements FS.
+func (p *permFS) Lchown(name string, uid, gid int) error {
+	fi, err := p.stat(name, false)
+	if err != nil {
+		return err
+	}
+	if err := p.id.canChown(fi, uid, gid); err != nil {
+		return err
+	}
+	return p.fs.Lchown(name, uid, gid)
+}
+
+// Chtimes implements FS. Setting given times takes owning the file.
+func (p *permFS) Chtimes(name string, atime, mtime time.Time) error {
+	fi, err := p.stat(name, true)
+	if err != nil {
+		return err
+	}
+	if err := p.id.owns(fi); err != nil {
+		return err
+	}
+	return p.fs.Chtimes(name, atime, mtime)
+}
+
+// Link implements FS.
+func (p *permFS) Link(oldname, newname string) error {
+	if err := p.search(oldname); err != nil {
+		return err
+	}
+	if err := p.parent(newname, false); err != nil {
+		return err
+	}
+	return p.fs.Link(oldname, newname)
+}
+
+// Symlink implements FS.
+func (p *permFS) Symlink(oldname, newname string) error {
+	if err := p.parent(newname, false); err != nil {
+		return err
+	}
+	if err := p.fs.Symlink(oldname, newname); err != nil {
+		return err
+	}
+
+	p.own(newname)
+	return nil
+}
+
+// Readlink implements FS.
+func (p *permFS) Readlink(name string) (string, error) {
+	if err := p.search(name); err != nil {
+		return "", err
+	}
+	return p.fs.Readlink(name)
+}
+
+// permFile is a File of a permFS.
+type permFile struct {
+	File
+	id *Identity
+}
+
+func (f *permFile) Chmod(mode os.FileMode) error {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	if err := f.id.owns(fi); err != nil {
+		return err
+	}
+	return f.File.Chmod(mode)
+}
+
+func (f *permFile) Chown(uid, gid int) error {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return err
+	}
+	if err := f.id.canChown(fi, uid, gid); err != nil {
+		return err
+	}
+	return f.File.Chown(uid, gid)
+}
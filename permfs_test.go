@@ -0,0 +1,124 @@
+package wasmvm
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/perms/main.wasm ./testdata/perms
+
+// permTree returns a MemFS with files of root and of other users.
+func permTree(t *testing.T) *MemFS {
+	t.Helper()
+
+	fs := NewMemFS()
+	for _, dir := range []struct {
+		name     string
+		mode     os.FileMode
+		uid, gid int
+	}{
+		{"/root", 0700, 0, 0},
+		{"/etc", 0755, 0, 0},
+		{"/shared", 0775, 0, 100},
+		{"/tmp", 0777 | os.ModeSticky, 0, 0},
+	} {
+		if err := fs.Mkdir(dir.name, 0); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Chmod(dir.name, dir.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Chown(dir.name, dir.uid, dir.gid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, file := range []struct {
+		name     string
+		uid, gid int
+	}{
+		{"/root/secret", 0, 0},
+		{"/etc/conf", 0, 0},
+		{"/tmp/other", 2000, 2000},
+	} {
+		if err := writeFile(fs, file.name, strings.NewReader("data\n")); err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Chown(file.name, file.uid, file.gid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return fs
+}
+
+func TestPermissions(t *testing.T) {
+	fs := permTree(t)
+
+	got := runLogged(t, "testdata/perms/main.wasm", func(inst *Instance) {
+		inst.identity = Identity{UID: 1000, GID: 1000, Groups: []int{100}, Umask: 022}
+		inst.global["fs"] = newFSImport(inst, fs)
+	})
+
+	want := `uid 1000 gid 1000 euid 1000 egid 1000 groups [1000 100] <nil>
+read /root/secret: Permission denied
+readdir /root: Permission denied
+stat /root/secret: Permission denied
+read /etc/conf: ok
+write /etc/conf: Permission denied
+chmod /etc/conf: Operation not permitted
+chown /etc/conf: Operation not permitted
+chtimes /etc/conf: Operation not permitted
+create in /etc: Permission denied
+remove /etc/conf: Permission denied
+create in /shared: ok
+/shared/new.txt: -rw-r--r-- 1000:1000
+chmod own file: ok
+chown own file to a group of mine: ok
+chown own file to a foreign group: Operation not permitted
+chown own file to root: Operation not permitted
+chtimes own file: ok
+/shared/new.txt: -rw-r----- 1000:100
+fchmod read-only file: ok
+umask: 022
+mkdir with umask 077: ok
+/shared/private: drwx------ 1000:1000
+umask: 077
+remove foreign file in /tmp: Operation not permitted
+create in /tmp: ok
+remove own file in /tmp: ok
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	fi, err := fs.Stat("/etc/conf")
+	if err != nil || fi.Mode() != 0644 {
+		t.Errorf("/etc/conf changed: %v, %v", fi, err)
+	}
+}
+
+// The zero Identity is root, which only needs an execute bit to run files.
+func TestRootIdentity(t *testing.T) {
+	fs := permTree(t)
+	p := &permFS{fs: fs, id: &Identity{}}
+
+	if _, err := p.OpenFile("/root/secret", os.O_RDWR, 0); err != nil {
+		t.Errorf("open: %v", err)
+	}
+	if err := p.Chown("/tmp/other", 0, 0); err != nil {
+		t.Errorf("chown: %v", err)
+	}
+	if err := p.Unlink("/tmp/other"); err != nil {
+		t.Errorf("unlink: %v", err)
+	}
+
+	fi, err := fs.Stat("/etc/conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.id.access(fi, accessX); fsError(err).Code != "EACCES" {
+		t.Errorf("run a file without execute bits: %v", err)
+	}
+}
@@ -1,16 +1,65 @@
-package main
+package wasmvm
 
-import "fmt"
+import (
+	"os"
+	"path"
+)
 
-var importProcess = map[string]interface{}{
-	"getuid":    func() { fmt.Println("getuid") },
-	"getgid":    func() { fmt.Println("getgid") },
-	"geteuid":   func() { fmt.Println("geteuid") },
-	"getegid":   func() { fmt.Println("getegid") },
-	"getgroups": func() { fmt.Println("getgroups") },
-	"pid":       -1,
-	"ppid":      -1,
-	"umask":     func() { fmt.Println("umask") },
-	"cwd":       func() { fmt.Println("cwd") },
-	"chdir":     func() { fmt.Println("chdir") },
+// newProcessImport returns the process object of inst, which reports the
+// identity, IDs and working directory of inst.
+func newProcessImport(inst *Instance) map[string]interface{} {
+	id := &inst.identity
+	pid := inst.rt.opts.PID
+	if pid == 0 {
+		pid = 1
+	}
+
+	return map[string]interface{}{
+		"getuid":  func() int { return id.UID },
+		"getgid":  func() int { return id.GID },
+		"geteuid": func() int { return id.UID },
+		"getegid": func() int { return id.GID },
+		"getgroups": func() []int {
+			return append([]int{id.GID}, id.Groups...)
+		},
+		"pid":  pid,
+		"ppid": inst.rt.opts.PPID,
+		// umask sets the umask of the guest and returns the previous one.
+		"umask": func(mask int) int {
+			old := id.Umask
+			id.Umask = os.FileMode(mask) & os.ModePerm
+			return int(old)
+		},
+		"cwd":   func() string { return inst.cwd },
+		"chdir": inst.chdir,
+	}
+}
+
+// abs returns the absolute FS name of the guest path name, which is relative
+// to the working directory when it is not absolute.
+func (inst *Instance) abs(name string) string {
+	if path.IsAbs(name) {
+		return path.Clean(name)
+	}
+	return path.Join(inst.cwd, name)
+}
+
+// chdir makes dir the working directory, if it is a directory the guest may
+// search.
+func (inst *Instance) chdir(dir string) error {
+	name := inst.abs(dir)
+
+	fi, err := inst.files.fs.Stat(name)
+	if err != nil {
+		return fsError(err)
+	}
+	if !fi.IsDir() {
+		return errno("ENOTDIR")
+	}
+	if err := inst.identity.access(fi, accessX); err != nil {
+		return err
+	}
+
+	inst.cwd = name
+	return nil
 }
@@ -0,0 +1,37 @@
+package wasmvm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	fs := permTree(t)
+	if err := writeFile(fs, "/etc/hello.txt", strings.NewReader("hello\n")); err != nil {
+		t.Fatal(err)
+	}
+	user := Identity{UID: 1000, GID: 1000}
+
+	for _, test := range []struct {
+		name string
+		opts Options
+		dir  string
+		want string
+	}{
+		{"defaults", Options{FS: fs}, "etc",
+			"cwd: / <nil>\npid: 1, ppid: 0\nread relative: open hello.txt: No such file or directory (errno 2)\nchdir: ok\n"},
+		{"configured", Options{FS: fs, Dir: "/etc", PID: 42, PPID: 7}, "/tmp",
+			"cwd: /etc <nil>\npid: 42, ppid: 7\nread relative: ok\nchdir: ok\n"},
+		{"not a directory", Options{FS: fs, Dir: "/etc"}, "conf",
+			"cwd: /etc <nil>\npid: 1, ppid: 0\nread relative: ok\nchdir: chdir conf: Not a directory (errno 20)\n"},
+		{"no search permission", Options{FS: fs, Dir: "/etc", Identity: user}, "/root",
+			"cwd: /etc <nil>\npid: 1, ppid: 0\nread relative: ok\nchdir: chdir /root: Permission denied (errno 13)\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := runWith(t, test.opts, "testdata/cwd/main.wasm", []string{"cwd", "info", test.dir})
+			if got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
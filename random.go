@@ -0,0 +1,38 @@
+package wasmvm
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxRandomValues is the most bytes crypto.getRandomValues fills at once, as
+// in the Web Crypto API.
+const maxRandomValues = 65536
+
+// readRandom fills p from the entropy source of inst. The guest must not go
+// on with predictable bytes, so failing to read is fatal to it.
+func (inst *Instance) readRandom(p []byte) {
+	if _, err := io.ReadFull(inst.random, p); err != nil {
+		panic(fmt.Errorf("reading random data: %w", err))
+	}
+}
+
+// newCrypto returns the crypto object of inst, whose getRandomValues fills
+// integer typed arrays from the entropy source of inst. crypto/rand uses it.
+func newCrypto(inst *Instance) map[string]interface{} {
+	return map[string]interface{}{
+		"getRandomValues": func(v interface{}) (*TypedArray, error) {
+			a, ok := v.(*TypedArray)
+			if !ok || a.kind.name == "Float32" || a.kind.name == "Float64" {
+				return nil, &Error{Message: "TypeMismatchError: the argument is not an integer typed array"}
+			}
+			b := a.Bytes()
+			if len(b) > maxRandomValues {
+				return nil, &Error{Message: fmt.Sprintf("QuotaExceededError: %d bytes requested, more than %d", len(b), maxRandomValues)}
+			}
+
+			inst.readRandom(b)
+			return a, nil
+		},
+	}
+}
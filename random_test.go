@@ -0,0 +1,92 @@
+package wasmvm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/random/main.wasm ./testdata/random
+
+// constReader reads as the same byte over and over.
+type constReader byte
+
+func (r constReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestRandom(t *testing.T) {
+	got := runWith(t, Options{Random: constReader(0xab)}, "testdata/random/main.wasm", nil)
+	if want := "read 100000 <nil>: abababababababab abababababababab\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The default source is the one of the host.
+	got = runWith(t, Options{}, "testdata/random/main.wasm", nil)
+	if !strings.HasPrefix(got, "read 100000 <nil>: ") || strings.Contains(got, "0000000000000000") {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSetRandom(t *testing.T) {
+	inst := loadWasm(t, NewRuntime(Options{Random: constReader(0xab)}), "testdata/random/main.wasm")
+	inst.SetRandom(constReader(0xcd))
+
+	var log strings.Builder
+	inst.Global()["console"] = map[string]interface{}{
+		"log": func(line string) { log.WriteString(line) },
+	}
+	if err := inst.Run(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "read 100000 <nil>: cdcdcdcdcdcdcdcd cdcdcdcdcdcdcdcd"; log.String() != want {
+		t.Errorf("got %q, want %q", log.String(), want)
+	}
+}
+
+// A guest whose entropy source fails stops rather than go on with
+// predictable bytes.
+func TestRandomFailure(t *testing.T) {
+	inst := loadWasm(t, NewRuntime(Options{}), "testdata/random/main.wasm")
+	inst.SetRandom(strings.NewReader("short"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	err := inst.Run(ctx, nil)
+	if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestGetRandomValues(t *testing.T) {
+	inst := newInstance(NewRuntime(Options{Random: constReader(0xab)}))
+	getRandomValues := inst.global["crypto"].(map[string]interface{})["getRandomValues"].(func(interface{}) (*TypedArray, error))
+
+	a := allocTypedArray(elementKindByName("Uint32"), 4)
+	if got, err := getRandomValues(a); got != a || err != nil {
+		t.Fatalf("got %v, %v", got, err)
+	}
+	if !bytes.Equal(a.Bytes(), bytes.Repeat([]byte{0xab}, 16)) {
+		t.Errorf("filled with % x", a.Bytes())
+	}
+
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{allocTypedArray(elementKindByName("Float64"), 1), "TypeMismatchError"},
+		{"not an array", "TypeMismatchError"},
+		{allocTypedArray(elementKindByName("Uint8"), maxRandomValues+1), "QuotaExceededError"},
+	} {
+		if _, err := getRandomValues(test.v); err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("getRandomValues(%v): got error %v, want %s", test.v, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package wasmvm
+
+import (
+	"os"
+	"time"
+)
+
+// readOnlyFS is an FS whose changes fail with EROFS.
+type readOnlyFS struct {
+	fs FS
+}
+
+// NewReadOnlyFS returns fs without the ability to change it.
+func NewReadOnlyFS(fs FS) FS {
+	return &readOnlyFS{fs: fs}
+}
+
+func (r *readOnlyFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if writable(flag) || flag&(os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, errno("EROFS")
+	}
+
+	f, err := r.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &readOnlyFile{f}, nil
+}
+
+func (r *readOnlyFS) Stat(name string) (os.FileInfo, error)  { return r.fs.Stat(name) }
+func (r *readOnlyFS) Lstat(name string) (os.FileInfo, error) { return r.fs.Lstat(name) }
+func (r *readOnlyFS) ReadDir(name string) ([]string, error)  { return r.fs.ReadDir(name) }
+func (r *readOnlyFS) Readlink(name string) (string, error)   { return r.fs.Readlink(name) }
+
+func (r *readOnlyFS) Mkdir(name string, perm os.FileMode) error         { return errno("EROFS") }
+func (r *readOnlyFS) Unlink(name string) error                          { return errno("EROFS") }
+func (r *readOnlyFS) Rmdir(name string) error                           { return errno("EROFS") }
+func (r *readOnlyFS) Rename(oldname, newname string) error              { return errno("EROFS") }
+func (r *readOnlyFS) Truncate(name string, size int64) error            { return errno("EROFS") }
+func (r *readOnlyFS) Chmod(name string, mode os.FileMode) error         { return errno("EROFS") }
+func (r *readOnlyFS) Chown(name string, uid, gid int) error             { return errno("EROFS") }
+func (r *readOnlyFS) Lchown(name string, uid, gid int) error            { return errno("EROFS") }
+func (r *readOnlyFS) Chtimes(name string, atime, mtime time.Time) error { return errno("EROFS") }
+func (r *readOnlyFS) Link(oldname, newname string) error                { return errno("EROFS") }
+func (r *readOnlyFS) Symlink(oldname, newname string) error             { return errno("EROFS") }
+
+// readOnlyFile is a File of a readOnlyFS.
+type readOnlyFile struct {
+	File
+}
+
+func (f *readOnlyFile) Truncate(size int64) error    { return errno("EINVAL") }
+func (f *readOnlyFile) Chmod(mode os.FileMode) error { return errno("EROFS") }
+func (f *readOnlyFile) Chown(uid, gid int) error     { return errno("EROFS") }
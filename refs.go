@@ -0,0 +1,194 @@
+package wasmvm
+
+import (
+	"math"
+	"reflect"
+	"unsafe"
+)
+
+// Type flags stored in the upper half of a boxed reference, as in wasm_exec.js.
+const (
+	typeFlagNone     = 0
+	typeFlagObject   = 1
+	typeFlagString   = 2
+	typeFlagSymbol   = 3
+	typeFlagFunction = 4
+)
+
+// Reference ids that are always present in the table.
+const (
+	refNaN = iota
+	refZero
+	refNull
+	refTrue
+	refFalse
+	refGlobal
+	refGo
+)
+
+// permanentRef is the reference count of the predefined values, which are
+// never released.
+const permanentRef = math.MaxInt32
+
+// Symbol is a JavaScript symbol. Every *Symbol is a distinct value.
+type Symbol struct {
+	Description string
+}
+
+// refTable holds the host values the guest currently has references to. Like
+// the _values/_ids/_goRefCounts/_idPool quartet of wasm_exec.js, a value
+// always gets the same id while the guest holds a reference to it.
+type refTable struct {
+	values      []interface{}
+	ids         map[interface{}]uint32
+	goRefCounts []int
+	idPool      []uint32
+}
+
+func newRefTable(global, scope interface{}) *refTable {
+	t := &refTable{
+		values: []interface{}{
+			refNaN:    math.NaN(),
+			refZero:   0.0,
+			refNull:   nil,
+			refTrue:   true,
+			refFalse:  false,
+			refGlobal: global,
+			refGo:     scope,
+		},
+		ids: map[interface{}]uint32{},
+	}
+
+	t.goRefCounts = make([]int, len(t.values))
+	for i := range t.goRefCounts {
+		t.goRefCounts[i] = permanentRef
+	}
+	t.ids[identityOf(global)] = refGlobal
+	t.ids[identityOf(scope)] = refGo
+
+	return t
+}
+
+// ref returns the id of v, adding it to the table if needed, and counts one
+// more guest reference to it.
+func (t *refTable) ref(v interface{}) uint32 {
+	key := identityOf(v)
+
+	id, ok := t.ids[key]
+	if !ok {
+		if n := len(t.idPool); n > 0 {
+			id = t.idPool[n-1]
+			t.idPool = t.idPool[:n-1]
+			t.values[id] = v
+			t.goRefCounts[id] = 0
+		} else {
+			id = uint32(len(t.values))
+			t.values = append(t.values, v)
+			t.goRefCounts = append(t.goRefCounts, 0)
+		}
+		if key != nil {
+			t.ids[key] = id
+		}
+	}
+
+	if t.goRefCounts[id] != permanentRef {
+		t.goRefCounts[id]++
+	}
+
+	return id
+}
+
+func (t *refTable) get(id uint32) interface{} {
+	if int(id) >= len(t.values) {
+		return nil
+	}
+	return t.values[id]
+}
+
+// replace makes id refer to v instead of the value it referred to.
+func (t *refTable) replace(id uint32, v interface{}) {
+	if int(id) >= len(t.values) {
+		return
+	}
+
+	if key := identityOf(t.values[id]); key != nil && t.ids[key] == id {
+		delete(t.ids, key)
+	}
+	t.values[id] = v
+	if key := identityOf(v); key != nil {
+		t.ids[key] = id
+	}
+}
+
+// finalize drops one guest reference to id and releases the id once the
+// guest holds none.
+func (t *refTable) finalize(id uint32) {
+	if int(id) >= len(t.goRefCounts) || t.goRefCounts[id] == permanentRef || t.goRefCounts[id] == 0 {
+		return
+	}
+
+	t.goRefCounts[id]--
+	if t.goRefCounts[id] == 0 {
+		if key := identityOf(t.values[id]); key != nil {
+			delete(t.ids, key)
+		}
+		t.values[id] = nil
+		t.idPool = append(t.idPool, id)
+	}
+}
+
+// refIdentity identifies reference types by what they point to instead of by
+// value, so the same map, slice, pointer or closure always maps to the same id.
+type refIdentity struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// identityOf returns the key used to look v up in the table, or nil when v
+// has no stable identity and should get a new id every time it is stored.
+func identityOf(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return refIdentity{typ: rv.Type(), ptr: rv.Pointer()}
+	case reflect.Slice:
+		return refIdentity{typ: rv.Type(), ptr: rv.Pointer(), len: rv.Len()}
+	case reflect.Func:
+		// Value.Pointer returns the code pointer, which is shared by every
+		// closure created from the same function literal. The interface data
+		// word points to the closure itself.
+		return refIdentity{typ: rv.Type(), ptr: uintptr((*[2]unsafe.Pointer)(unsafe.Pointer(&v))[1])}
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return v
+	}
+
+	return nil
+}
+
+// typeFlagOf returns the type flag wasm_exec.js would use for v.
+func typeFlagOf(v interface{}) uint32 {
+	switch v.(type) {
+	case nil:
+		return typeFlagNone
+	case string:
+		return typeFlagString
+	case *Symbol:
+		return typeFlagSymbol
+	case *Func, *Class:
+		return typeFlagFunction
+	}
+
+	if reflect.TypeOf(v).Kind() == reflect.Func {
+		return typeFlagFunction
+	}
+
+	return typeFlagObject
+}
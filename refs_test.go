@@ -0,0 +1,77 @@
+package wasmvm
+
+import "testing"
+
+func TestRefTableIdentity(t *testing.T) {
+	refs := newRefTable(map[string]interface{}{}, map[string]interface{}{})
+
+	obj := map[string]interface{}{"a": 1.0}
+	if a, b := refs.ref(obj), refs.ref(obj); a != b {
+		t.Errorf("same map got ids %d and %d", a, b)
+	}
+
+	if a, b := refs.ref("hello"), refs.ref("hello"); a != b {
+		t.Errorf("equal strings got ids %d and %d", a, b)
+	}
+
+	makeFunc := func(n int) func() int { return func() int { return n } }
+	f1, f2 := makeFunc(1), makeFunc(2)
+	if a, b := refs.ref(f1), refs.ref(f2); a == b {
+		t.Errorf("distinct closures share id %d", a)
+	}
+	if a, b := refs.ref(f1), refs.ref(f1); a != b {
+		t.Errorf("same closure got ids %d and %d", a, b)
+	}
+
+	if refs.ref(refs.get(refGlobal)) != refGlobal {
+		t.Error("global does not map to its predefined id")
+	}
+}
+
+func TestRefTableFinalize(t *testing.T) {
+	refs := newRefTable(map[string]interface{}{}, map[string]interface{}{})
+
+	obj := &Symbol{Description: "x"}
+	id := refs.ref(obj)
+	refs.ref(obj)
+
+	refs.finalize(id)
+	if refs.get(id) != obj {
+		t.Fatal("value released while still referenced")
+	}
+
+	refs.finalize(id)
+	if refs.get(id) != nil {
+		t.Fatal("value not released after last reference")
+	}
+
+	other := map[string]interface{}{}
+	if reused := refs.ref(other); reused != id {
+		t.Errorf("expected id %d to be reused, got %d", id, reused)
+	}
+	if newID := refs.ref(obj); newID == id {
+		t.Error("released value still mapped to its old id")
+	}
+
+	refs.finalize(refGlobal)
+	if refs.get(refGlobal) == nil {
+		t.Error("predefined value released")
+	}
+}
+
+func TestTypeFlags(t *testing.T) {
+	for _, tc := range []struct {
+		v    interface{}
+		flag uint32
+	}{
+		{nil, typeFlagNone},
+		{map[string]interface{}{}, typeFlagObject},
+		{"str", typeFlagString},
+		{&Symbol{}, typeFlagSymbol},
+		{func() {}, typeFlagFunction},
+	} {
+		if got := typeFlagOf(tc.v); got != tc.flag {
+			t.Errorf("typeFlagOf(%T) = %d, want %d", tc.v, got, tc.flag)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package wasmvm
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-interpreter/wagon/exec"
+	"github.com/go-interpreter/wagon/wasm"
+)
+
+// Options configures a Runtime and every Instance loaded from it.
+type Options struct {
+	// Resolve is used for imported modules other than the GOOS=js host
+	// module. If nil, such imports fail to load.
+	Resolve wasm.ResolveFunc
+
+	// KeepAlive keeps Run waiting for tasks passed to Instance.Post when the
+	// guest has nothing left to do, until its context is done. Otherwise an
+	// idle guest is woken up to report a deadlock, as under Node.js.
+	KeepAlive bool
+
+	// FS is the filesystem the guests see through the fs module. Instances
+	// share it; if nil, each instance gets its own empty MemFS, whose file
+	// times come from the clock of the instance.
+	FS FS
+
+	// Env is the environment of the guests, as os.Getenv sees it.
+	Env map[string]string
+
+	// Stdin is what the guests read from standard input. Reads wait for data
+	// without blocking the host, and a guest blocked in one keeps its
+	// instance running, but a read in progress when Run returns goes on
+	// until Stdin returns. Instances share it; if nil, standard input is
+	// empty.
+	Stdin io.Reader
+
+	// MaxOpenFiles is the number of file descriptors, standard streams
+	// included, a guest may have open at once. Opening more fails with
+	// EMFILE. If 0, it is 1024. Files left open are closed when Run returns.
+	MaxOpenFiles int
+
+	// Stdout and Stderr receive the standard output and error of the
+	// guests, in OutputFormat, unless Instance.SetOutput gives an instance
+	// its own. If nil, they are os.Stdout and os.Stderr. Writers shared by
+	// instances running in parallel must be safe for concurrent use.
+	Stdout, Stderr io.Writer
+	OutputFormat   OutputFormat
+
+	// Identity is the user the guests run as. Each instance starts with a
+	// copy of it, and the guest may change its umask.
+	Identity Identity
+
+	// Clock is the time of the guests, for the time they read and their
+	// timers, unless Instance.SetClock gives an instance its own. If nil, it
+	// is the RealClock of the host; a VirtualClock lets tests control time.
+	Clock Clock
+
+	// Random is the entropy source of the guests, for crypto/rand and the
+	// seeds of the runtime, unless Instance.SetRandom gives an instance its
+	// own. If nil, it is crypto/rand.Reader. Instances running in parallel
+	// may read it concurrently.
+	Random io.Reader
+
+	// Dir is the working directory the guests start in, which relative
+	// paths are resolved against; / if empty.
+	Dir string
+
+	// PID and PPID are the process IDs os.Getpid and os.Getppid report. If
+	// PID is 0, it is 1, as for the first process of a container.
+	PID, PPID int
+}
+
+// Runtime loads GOOS=js WebAssembly modules into wagon VMs.
+type Runtime struct {
+	opts Options
+	// instances counts the instances loaded, to number them.
+	instances uint64
+}
+
+// NewRuntime creates a Runtime with the given options.
+func NewRuntime(opts Options) *Runtime {
+	return &Runtime{
+		opts: opts,
+	}
+}
+
+// Load reads a WebAssembly module from r and prepares an Instance ready to Run.
+func (rt *Runtime) Load(r io.Reader) (*Instance, error) {
+	inst := newInstance(rt)
+
+	m, err := readModule(r, inst.importer)
+	if err != nil {
+		return nil, fmt.Errorf("reading module: %v", err)
+	}
+
+	if err := lowerBulkMemory(m); err != nil {
+		return nil, fmt.Errorf("reading module: %v", err)
+	}
+
+	vm, err := exec.NewVM(m)
+	if err != nil {
+		return nil, fmt.Errorf("creating vm: %v", err)
+	}
+	vm.RecoverPanic = true
+
+	inst.module = m
+	inst.vm = vm
+
+	return inst, nil
+}
@@ -0,0 +1,53 @@
+package wasmvm
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/stdin/main.wasm ./testdata/stdin
+
+func TestStdin(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		stdin io.Reader
+		want  string
+	}{
+		{"empty", nil, "done: 0 lines, <nil>\n"},
+		{"pipeline", strings.NewReader("one\ntwo\n\nlast without newline"),
+			"line 1: one\nline 2: two\nline 3: \nline 4: last without newline\ndone: 4 lines, <nil>\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := runWith(t, Options{Stdin: test.stdin}, "testdata/stdin/main.wasm", nil)
+			if want := test.want + "write stdin: true\n"; got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// A guest waiting for input keeps running its timers, and gets the input
+// once it comes.
+func TestStdinWaitsForInput(t *testing.T) {
+	r, w := io.Pipe()
+
+	got := runWith(t, Options{Stdin: r}, "testdata/stdin/main.wasm", []string{"stdin", "timer"}, func(inst *Instance) {
+		console := inst.global["console"].(map[string]interface{})
+		log := console["log"].(func(string))
+		console["log"] = func(line string) {
+			log(line)
+			if line == "timer fired" {
+				go func() {
+					io.WriteString(w, "typed after the timer\n")
+					w.Close()
+				}()
+			}
+		}
+	})
+
+	want := "timer fired\nline 1: typed after the timer\ndone: 1 lines, <nil>\nwrite stdin: true\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,197 @@
+package wasmvm
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// structBinding is the accessor table of a struct type, or of a pointer to
+// one: the fields and methods the guest can use, by JavaScript name.
+type structBinding struct {
+	fields  map[string][]int
+	names   []string
+	methods map[string]int
+}
+
+// structBindings caches a *structBinding per reflect.Type. Instances running
+// in different goroutines share it.
+var structBindings sync.Map
+
+// bindingOf returns the accessor table of t, which must be a struct type or
+// a pointer to one.
+func bindingOf(t reflect.Type) *structBinding {
+	if b, ok := structBindings.Load(t); ok {
+		return b.(*structBinding)
+	}
+
+	b := &structBinding{
+		fields:  map[string][]int{},
+		methods: map[string]int{},
+	}
+
+	st := t
+	if st.Kind() == reflect.Ptr {
+		st = st.Elem()
+	}
+	b.addFields(st, nil)
+
+	for i := 0; i < t.NumMethod(); i++ {
+		name := camelCase(t.Method(i).Name)
+		if _, ok := b.fields[name]; !ok {
+			b.methods[name] = i
+		}
+	}
+
+	actual, _ := structBindings.LoadOrStore(t, b)
+	return actual.(*structBinding)
+}
+
+// addFields adds the exported fields of st, and those promoted from its
+// exported embedded structs. Fields of the outer struct win, like in Go.
+func (b *structBinding) addFields(st reflect.Type, index []int) {
+	var embedded []reflect.StructField
+
+	for i := 0; i < st.NumField(); i++ {
+		f := st.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := camelCase(f.Name)
+		if tag, ok := f.Tag.Lookup("js"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag = strings.Split(tag, ",")[0]; tag != "" {
+				name = tag
+			}
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && ft.Kind() == reflect.Struct {
+			if _, tagged := f.Tag.Lookup("js"); !tagged {
+				embedded = append(embedded, f)
+				continue
+			}
+		}
+
+		if _, ok := b.fields[name]; ok {
+			continue
+		}
+		b.fields[name] = append(append([]int{}, index...), i)
+		b.names = append(b.names, name)
+	}
+
+	for _, f := range embedded {
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		b.addFields(ft, append(append([]int{}, index...), f.Index...))
+	}
+}
+
+// camelCase returns the JavaScript name of the Go identifier name: its
+// leading upper case letters, or acronym, are lowered, so Name becomes name,
+// ID id and URLPath urlPath.
+func camelCase(name string) string {
+	runes := []rune(name)
+
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) && unicode.IsLower(runes[n]) {
+		n--
+	}
+
+	for i := 0; i < n; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
+
+// structValue returns obj as a struct and its binding, if obj is a struct or
+// a non-nil pointer to one.
+func structValue(obj interface{}) (reflect.Value, *structBinding, bool) {
+	v := reflect.ValueOf(obj)
+	s := reflect.Indirect(v)
+	if s.Kind() != reflect.Struct || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return reflect.Value{}, nil, false
+	}
+
+	return s, bindingOf(v.Type()), true
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex without the panic on nil
+// embedded pointers.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v, true
+}
+
+// structProperty returns the field or method of the struct obj named key.
+// Fields holding structs or arrays are returned as pointers when obj is a
+// pointer, so the guest can modify them in place.
+func structProperty(obj interface{}, key string) (interface{}, bool) {
+	s, b, ok := structValue(obj)
+	if !ok {
+		return nil, false
+	}
+
+	if index, ok := b.fields[key]; ok {
+		f, ok := fieldByIndex(s, index)
+		if !ok {
+			return Undefined, true
+		}
+		if k := f.Kind(); (k == reflect.Struct || k == reflect.Array) && f.CanAddr() {
+			return f.Addr().Interface(), true
+		}
+		return f.Interface(), true
+	}
+
+	if i, ok := b.methods[key]; ok {
+		return reflect.ValueOf(obj).Method(i).Interface(), true
+	}
+
+	return nil, false
+}
+
+// setStructProperty sets the field key of the struct obj points to. It does
+// nothing when obj is not a pointer, as its fields cannot be set, or when x
+// cannot be converted to the type of the field.
+func setStructProperty(obj interface{}, key string, x interface{}) {
+	s, b, ok := structValue(obj)
+	if !ok {
+		return
+	}
+
+	index, ok := b.fields[key]
+	if !ok {
+		return
+	}
+
+	f, ok := fieldByIndex(s, index)
+	if !ok || !f.CanSet() {
+		return
+	}
+
+	if v, err := convertValue(x, f.Type()); err == nil {
+		f.Set(v)
+	}
+}
@@ -0,0 +1,95 @@
+package wasmvm
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//go:generate env GOTOOLCHAIN=go1.21.13 GOOS=js GOARCH=wasm go build -o testdata/structs/main.wasm ./testdata/structs
+
+type Audit struct {
+	CreatedBy string
+}
+
+type Extra struct {
+	ExtraNote string
+}
+
+type testPoint struct {
+	X, Y float64
+}
+
+type testUser struct {
+	Name     string
+	Email    string `js:"mail"`
+	Password string `js:"-"`
+	Location testPoint
+	URLPath  string
+	secret   string
+	Audit
+	*Extra
+}
+
+func (u *testUser) Greet(greeting string) string {
+	return greeting + ", " + u.Name
+}
+
+func (u testUser) Initials() string {
+	var initials string
+	for _, word := range strings.Fields(u.Name) {
+		initials += word[:1]
+	}
+	return initials
+}
+
+func TestStructBinding(t *testing.T) {
+	want, err := ioutil.ReadFile("testdata/structs/want.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &testUser{
+		Name:     "Ken Thompson",
+		Email:    "ken@example.com",
+		Password: "hunter2",
+		Location: testPoint{1, 2},
+		URLPath:  "/ken",
+		secret:   "unix",
+		Audit:    Audit{CreatedBy: "admin"},
+	}
+	got := runLogged(t, "testdata/structs/main.wasm", func(inst *Instance) {
+		inst.Global()["user"] = user
+		inst.Global()["frozen"] = *user
+	})
+
+	if got != string(want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if user.Name != "Rob" || user.Location.X != 3 || user.Email != "ken@example.com" {
+		t.Errorf("user is %+v after the guest changed it", user)
+	}
+}
+
+func TestCamelCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"Name":        "name",
+		"ID":          "id",
+		"URLPath":     "urlPath",
+		"HTTP2Server": "http2Server",
+		"already":     "already",
+		"X":           "x",
+	} {
+		if got := camelCase(name); got != want {
+			t.Errorf("camelCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBindingsAreCached(t *testing.T) {
+	typ := reflect.TypeOf(&testUser{})
+	if bindingOf(typ) != bindingOf(typ) {
+		t.Error("binding computed twice")
+	}
+}
@@ -0,0 +1,99 @@
+package wasmvm
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+)
+
+// NewTarFS reads the tar archive r into memory and returns a read-only FS
+// with its files. Modes, owners and times are kept.
+func NewTarFS(r io.Reader) (FS, error) {
+	fs := NewMemFS()
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := cleanPath(hdr.Name)
+		if err := mkdirAll(fs, path.Dir(name), 0755); err != nil {
+			return nil, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = mkdirAll(fs, name, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(fs, name, tr)
+		case tar.TypeSymlink:
+			err = fs.Symlink(hdr.Linkname, name)
+		case tar.TypeLink:
+			err = fs.Link(cleanPath(hdr.Linkname), name)
+		default:
+			// Devices and other special files have no place in a MemFS.
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "untar", Path: hdr.Name, Err: err}
+		}
+
+		if hdr.Typeflag == tar.TypeSymlink {
+			if err := fs.Lchown(name, hdr.Uid, hdr.Gid); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := fs.Chmod(name, fileMode(uint32(hdr.Mode))); err != nil {
+			return nil, err
+		}
+		if err := fs.Chown(name, hdr.Uid, hdr.Gid); err != nil {
+			return nil, err
+		}
+		atime := hdr.AccessTime
+		if atime.IsZero() {
+			atime = hdr.ModTime
+		}
+		if err := fs.Chtimes(name, atime, hdr.ModTime); err != nil {
+			return nil, err
+		}
+	}
+
+	return NewReadOnlyFS(fs), nil
+}
+
+// writeFile creates the file name in fs with the contents of r.
+func writeFile(fs FS, name string, r io.Reader) error {
+	f, err := fs.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	var off int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := f.WriteAt(buf[:n], off); err != nil {
+				f.Close()
+				return err
+			}
+			off += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
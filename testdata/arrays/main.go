@@ -0,0 +1,70 @@
+// Command arrays exercises JavaScript arrays through syscall/js and logs what
+// it observes with console.log.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func dump(name string, a js.Value) {
+	items := ""
+	for i := 0; i < a.Length(); i++ {
+		if i > 0 {
+			items += " "
+		}
+		items += a.Index(i).Type().String()
+		if t := a.Index(i).Type(); t == js.TypeNumber || t == js.TypeString {
+			items += "(" + a.Index(i).String() + ")"
+		}
+	}
+	log("%s: length=%d [%s]", name, a.Length(), items)
+}
+
+func main() {
+	Array := js.Global().Get("Array")
+	Object := js.Global().Get("Object")
+
+	a := js.ValueOf([]interface{}{1, "two", nil, true, []interface{}{5}})
+	dump("valueOf", a)
+	dump("nested", a.Index(4))
+	log("out of range: %s", a.Index(10).Type())
+
+	a.SetIndex(1, 2)
+	a.SetIndex(7, "grown")
+	dump("grown", a)
+
+	empty := Array.New(3)
+	dump("new(3)", empty)
+	dump("new(1, 2)", Array.New(1, 2))
+	dump("new()", Array.New())
+	dump("new(str)", Array.New("x"))
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log("new(-1): threw")
+			}
+		}()
+		Array.New(-1)
+	}()
+
+	isArray := Array.Get("isArray")
+	log("isArray: %v %v %v", isArray.Invoke(a).Bool(), isArray.Invoke(Object.New()).Bool(), isArray.Invoke(1).Bool())
+	log("instanceof: %v %v %v", a.InstanceOf(Array), a.InstanceOf(Object), Object.New().InstanceOf(Array))
+	log("length property: %d", a.Get("length").Int())
+	log("type: %s", a.Type())
+
+	obj := Object.New()
+	obj.Set("list", a)
+	obj.Get("list").SetIndex(0, "same")
+	log("shared: %s", a.Index(0).String())
+
+	log("done")
+}
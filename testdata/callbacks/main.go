@@ -0,0 +1,46 @@
+// Command callbacks exercises host calls into js.FuncOf functions, including
+// nested ones. The host provides apply(f, x), which returns f(x), and
+// report(name, value) to collect the results.
+package main
+
+import "syscall/js"
+
+// grow uses enough stack to make the runtime move it.
+func grow(n int) int {
+	var buf [1024]byte
+	buf[n%len(buf)] = byte(n)
+	if n == 0 {
+		return int(buf[0])
+	}
+	return grow(n-1) + int(buf[n%len(buf)])
+}
+
+func main() {
+	global := js.Global()
+
+	double := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return args[0].Int() * 2
+	})
+	global.Call("report", "double", global.Call("apply", double, 21))
+
+	var sum js.Func
+	sum = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		n := args[0].Int()
+		if n == 0 {
+			return 0
+		}
+		return global.Call("apply", sum, n-1).Int() + n + grow(64) - grow(64)
+	})
+	global.Call("report", "sum", global.Call("apply", sum, 10))
+
+	done := make(chan struct{})
+	js.Global().Set("square", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return args[0].Int() * args[0].Int()
+	}))
+	js.Global().Set("done", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		close(done)
+		return nil
+	}))
+	<-done
+	global.Call("report", "done", true)
+}
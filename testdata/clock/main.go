@@ -0,0 +1,38 @@
+// Command clock sleeps for an hour, with a timer firing half way, and logs
+// with console.log the times it reads. With "stdin" as its argument, it
+// reads its standard input meanwhile, so it is never idle.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall/js"
+	"time"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "stdin" {
+		go io.Copy(io.Discard, os.Stdin)
+	}
+
+	start := time.Now()
+	log("start: %s", start.UTC().Format(time.RFC3339Nano))
+
+	half := time.After(30 * time.Minute)
+	go func() {
+		<-half
+		log("timer after %v", time.Since(start).Round(time.Minute))
+	}()
+
+	time.Sleep(time.Hour)
+	end := time.Now()
+	log("end: %s", end.UTC().Format(time.RFC3339Nano))
+	log("slept %v, wall clock moved %v", end.Sub(start), end.Round(0).Sub(start.Round(0)))
+}
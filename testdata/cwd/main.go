@@ -0,0 +1,106 @@
+// Command cwd changes its working directory and uses relative paths, logging
+// what it observes with console.log. It works in the directory given as its
+// argument, /cwdtest by default, which must not exist yet.
+//
+// With "info" as its argument, it instead logs its working directory and
+// process IDs, reads hello.txt, and changes to the directory given next.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+var base = "/cwdtest"
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// check logs the result of op, without the working directory in errors.
+func check(op string, err error) {
+	if err == nil {
+		log("%s: ok", op)
+		return
+	}
+
+	msg := strings.ReplaceAll(err.Error(), base, "$BASE")
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		log("%s: %s (errno %d)", op, msg, int(errno))
+		return
+	}
+	log("%s: %s", op, msg)
+}
+
+// wd logs the working directory.
+func wd() {
+	dir, err := os.Getwd()
+	check("getwd", err)
+	log("cwd: %s", strings.Replace(dir, base, "$BASE", 1))
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "info" {
+		dir, err := os.Getwd()
+		log("cwd: %s %v", dir, err)
+		log("pid: %d, ppid: %d", os.Getpid(), os.Getppid())
+		_, err = os.ReadFile("hello.txt")
+		check("read relative", err)
+		if len(os.Args) > 2 {
+			check("chdir", os.Chdir(os.Args[2]))
+		}
+		return
+	}
+	if len(os.Args) > 1 {
+		base = os.Args[1]
+	}
+
+	check("mkdir base", os.Mkdir(base, 0755))
+	check("chdir base", os.Chdir(base))
+	wd()
+
+	check("writefile relative", os.WriteFile("a.txt", []byte("in base\n"), 0644))
+	check("mkdir relative", os.Mkdir("sub", 0755))
+	check("mkdirall relative", os.MkdirAll("sub/deep/er", 0755))
+	check("chdir relative", os.Chdir("sub/deep"))
+	wd()
+
+	data, err := os.ReadFile("../../a.txt")
+	check("readfile dotdot", err)
+	log("contents: %q", data)
+	check("rename relative", os.Rename("../../a.txt", "b.txt"))
+	fi, err := os.Stat("b.txt")
+	check("stat relative", err)
+	if err == nil {
+		log("size: %d", fi.Size())
+	}
+	check("symlink relative", os.Symlink("b.txt", "link"))
+	data, err = os.ReadFile("./link")
+	check("read symlink", err)
+	log("contents: %q", data)
+	names, err := os.ReadDir(".")
+	check("readdir dot", err)
+	for _, e := range names {
+		log("entry: %s", e.Name())
+	}
+
+	check("chdir missing", os.Chdir("missing"))
+	check("chdir file", os.Chdir("b.txt"))
+	wd()
+	check("chdir dotdot", os.Chdir("../.."))
+	wd()
+	check("chdir absolute", os.Chdir(base+"/sub/deep/er"))
+	wd()
+	check("remove cwd", os.Remove(base+"/sub/deep/er"))
+	check("chdir back", os.Chdir(base))
+	check("removeall relative", os.RemoveAll("sub"))
+	_, err = os.Stat("sub")
+	check("stat removed", err)
+}
@@ -0,0 +1,22 @@
+// Command env logs its arguments and environment with console.log.
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+func main() {
+	for i, arg := range os.Args {
+		console.Call("log", fmt.Sprintf("arg %d: %q", i, arg))
+	}
+	for _, kv := range os.Environ() {
+		console.Call("log", fmt.Sprintf("env: %q", kv))
+	}
+
+	home, ok := os.LookupEnv("HOME")
+	console.Call("log", fmt.Sprintf("HOME: %q %v", home, ok))
+}
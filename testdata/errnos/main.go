@@ -0,0 +1,34 @@
+// Command errnos stats a file named after each code of the global codes,
+// which the host fails with that code, and logs the error the guest gets and
+// how the checks of package os classify it.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func main() {
+	codes := js.Global().Get("codes")
+	for i := 0; i < codes.Length(); i++ {
+		code := codes.Index(i).String()
+		_, err := os.Stat("/" + code)
+
+		var errno syscall.Errno
+		if !errors.As(err, &errno) {
+			log("%s: not an errno: %v", code, err)
+			continue
+		}
+		log("%s: %d %v notexist=%v exist=%v permission=%v",
+			code, int(errno), errno, os.IsNotExist(err), os.IsExist(err), os.IsPermission(err))
+	}
+}
@@ -0,0 +1,40 @@
+// Command exit exits in the way given by its argument, logging with
+// console.log what it does until then.
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall/js"
+	"time"
+)
+
+var console = js.Global().Get("console")
+
+func main() {
+	// A pending timer does not keep the program alive.
+	go func() {
+		time.Sleep(time.Hour)
+		console.Call("log", "timer fired")
+	}()
+
+	switch os.Args[1] {
+	case "code":
+		fmt.Print("partial line")
+		os.Exit(3)
+	case "callback":
+		// The host calls back into the guest, which exits there.
+		exit := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			console.Call("log", "exiting in callback")
+			os.Exit(4)
+			return nil
+		})
+		js.Global().Call("call", exit)
+		console.Call("log", "returned from callback")
+	case "panic":
+		panic("boom")
+	case "return":
+	}
+
+	console.Call("log", "end of main")
+}
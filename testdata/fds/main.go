@@ -0,0 +1,173 @@
+// Command fds exercises file descriptors through the syscall package:
+// positional reads and writes, offsets, truncation, syncing and the errors of
+// bad descriptors. It logs what it observes with console.log, and works in
+// the directory given as its argument, /fdtest by default, which must not
+// exist yet.
+//
+// With "limit" as its second argument, it instead opens files until it runs
+// out of descriptors.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+var base = "/fdtest"
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// p returns the path of name in the working directory.
+func p(name string) string {
+	return base + "/" + name
+}
+
+// check logs the result of op, without the working directory in errors.
+func check(op string, err error) {
+	if err == nil {
+		log("%s: ok", op)
+		return
+	}
+
+	msg := strings.ReplaceAll(err.Error(), base, "$BASE")
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		log("%s: %s (errno %d)", op, msg, int(errno))
+		return
+	}
+	log("%s: %s", op, msg)
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		base = os.Args[1]
+	}
+	check("mkdir base", os.Mkdir(base, 0755))
+
+	if len(os.Args) > 2 && os.Args[2] == "limit" {
+		limit()
+		return
+	}
+
+	fd, err := syscall.Open(p("data.bin"), syscall.O_CREAT|syscall.O_RDWR, 0644)
+	check("open", err)
+
+	n, err := syscall.Write(fd, []byte("0123456789"))
+	log("write: %d %v", n, err)
+	n, err = syscall.Pwrite(fd, []byte("ab"), 2)
+	log("pwrite: %d %v", n, err)
+	n, err = syscall.Write(fd, []byte("XY"))
+	log("write after pwrite: %d %v", n, err)
+
+	buf := make([]byte, 4)
+	n, err = syscall.Pread(fd, buf, 1)
+	log("pread: %d %q %v", n, buf[:n], err)
+	n, err = syscall.Pread(fd, buf, 10)
+	log("pread at end: %d %q %v", n, buf[:n], err)
+	n, err = syscall.Pread(fd, buf, 20)
+	log("pread past end: %d %v", n, err)
+	n, err = syscall.Pwrite(fd, []byte("!"), 14)
+	log("pwrite past end: %d %v", n, err)
+
+	check("fsync", syscall.Fsync(fd))
+	check("ftruncate", syscall.Ftruncate(fd, 5))
+	check("ftruncate negative", syscall.Ftruncate(fd, -1))
+	var st syscall.Stat_t
+	check("fstat", syscall.Fstat(fd, &st))
+	log("size: %d", st.Size)
+	check("ftruncate grow", syscall.Ftruncate(fd, 8))
+	n, err = syscall.Pread(fd, buf, 4)
+	log("pread zeros: %d %q %v", n, buf[:n], err)
+	check("close", syscall.Close(fd))
+
+	check("close closed", syscall.Close(fd))
+	_, err = syscall.Read(fd, buf)
+	check("read closed", err)
+	_, err = syscall.Write(fd, buf)
+	check("write closed", err)
+	_, err = syscall.Pread(fd, buf, 0)
+	check("pread closed", err)
+	check("fsync closed", syscall.Fsync(fd))
+	check("ftruncate closed", syscall.Ftruncate(fd, 0))
+	check("fstat closed", syscall.Fstat(fd, &st))
+	check("fchmod closed", syscall.Fchmod(fd, 0600))
+	check("fsync unknown", syscall.Fsync(1000))
+
+	ro, err := syscall.Open(p("data.bin"), syscall.O_RDONLY, 0)
+	check("open read-only", err)
+	_, err = syscall.Write(ro, buf)
+	check("write read-only", err)
+	_, err = syscall.Pwrite(ro, buf, 0)
+	check("pwrite read-only", err)
+	check("ftruncate read-only", syscall.Ftruncate(ro, 0))
+	n, err = syscall.Read(ro, buf)
+	log("read: %d %q %v", n, buf[:n], err)
+
+	wo, err := syscall.Open(p("data.bin"), syscall.O_WRONLY|syscall.O_APPEND, 0)
+	check("open append", err)
+	_, err = syscall.Read(wo, buf)
+	check("read write-only", err)
+	n, err = syscall.Pwrite(wo, []byte("end"), 0)
+	log("pwrite append: %d %v", n, err)
+	check("close append", syscall.Close(wo))
+
+	n, err = syscall.Read(ro, buf)
+	log("read on: %d %q %v", n, buf[:n], err)
+	n, err = syscall.Pread(ro, make([]byte, 16), 0)
+	log("pread all: %d %v", n, err)
+	check("close read-only", syscall.Close(ro))
+
+	// Descriptors are reused, lowest first.
+	a, _ := syscall.Open(p("data.bin"), syscall.O_RDONLY, 0)
+	b, _ := syscall.Open(p("data.bin"), syscall.O_RDONLY, 0)
+	syscall.Close(a)
+	c, _ := syscall.Open(p("data.bin"), syscall.O_RDONLY, 0)
+	log("reused: %v, distinct: %v", c == a, b != a)
+	syscall.Close(b)
+	syscall.Close(c)
+
+	// Files left open are closed when the program exits.
+	_, err = syscall.Open(p("data.bin"), syscall.O_RDONLY, 0)
+	check("open left open", err)
+}
+
+// limit opens files until it gets an error, then checks that opens failing
+// for lack of descriptors change no file and that closing one lets it open
+// another.
+func limit() {
+	check("writefile", os.WriteFile(p("f"), []byte("kept"), 0644))
+
+	var fds []int
+	for {
+		fd, err := syscall.Open(p("f"), syscall.O_RDONLY, 0)
+		if err != nil {
+			log("opened %d", len(fds))
+			check("open over limit", err)
+			break
+		}
+		fds = append(fds, fd)
+	}
+
+	_, err := syscall.Open(p("f"), syscall.O_WRONLY|syscall.O_TRUNC, 0)
+	check("truncate over limit", err)
+	_, err = syscall.Open(p("new"), syscall.O_WRONLY|syscall.O_CREAT, 0644)
+	check("create over limit", err)
+
+	check("close one", syscall.Close(fds[0]))
+	data, err := os.ReadFile(p("f"))
+	log("contents: %q %v", data, err)
+	_, err = os.Stat(p("new"))
+	check("stat new", err)
+
+	fd, err := syscall.Open(p("f"), syscall.O_RDONLY, 0)
+	check("open again", err)
+	log("reused: %v", fd == fds[0])
+}
@@ -0,0 +1,164 @@
+// Command fs exercises the fs module through the os package and logs what it
+// observes with console.log. It works in the directory given as its argument,
+// /fstest by default, which must not exist yet.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+var base = "/fstest"
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// p returns the path of name in the working directory.
+func p(name string) string {
+	return base + "/" + name
+}
+
+// check logs the result of op, without the working directory in errors.
+func check(op string, err error) {
+	if err == nil {
+		log("%s: ok", op)
+		return
+	}
+
+	msg := strings.ReplaceAll(err.Error(), base, "$BASE")
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		log("%s: %s (errno %d)", op, msg, int(errno))
+		return
+	}
+	log("%s: %s", op, msg)
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		base = os.Args[1]
+	}
+
+	check("mkdir base", os.Mkdir(base, 0755))
+	check("mkdir again", os.Mkdir(base, 0755))
+	check("mkdir missing parent", os.Mkdir(p("a/b"), 0755))
+	check("mkdirall", os.MkdirAll(p("a/b/c"), 0755))
+
+	check("writefile", os.WriteFile(p("hello.txt"), []byte("hello, world\n"), 0644))
+	data, err := os.ReadFile(p("hello.txt"))
+	check("readfile", err)
+	log("contents: %q", data)
+
+	_, err = os.ReadFile(p("missing.txt"))
+	check("readfile missing", err)
+	log("is not exist: %v", os.IsNotExist(err))
+
+	_, err = os.OpenFile(p("hello.txt"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	check("create exclusive", err)
+	log("is exist: %v", os.IsExist(err))
+
+	_, err = os.ReadFile(p("hello.txt/x"))
+	check("file as directory", err)
+
+	f, err := os.OpenFile(p("hello.txt"), os.O_APPEND|os.O_WRONLY, 0)
+	check("open append", err)
+	_, err = f.WriteString("appended\n")
+	check("append", err)
+	_, err = f.Read(make([]byte, 1))
+	check("read write-only", err)
+	check("close", f.Close())
+	check("close again", f.Close())
+	data, _ = os.ReadFile(p("hello.txt"))
+	log("contents: %q", data)
+
+	f, err = os.OpenFile(p("rw.bin"), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0600)
+	check("create rw", err)
+	_, err = f.Write([]byte("0123456789"))
+	check("write", err)
+	off, err := f.Seek(2, io.SeekStart)
+	check("seek", err)
+	buf := make([]byte, 4)
+	n, err := f.Read(buf)
+	check("read after seek", err)
+	log("read %d at %d: %q", n, off, buf[:n])
+	_, err = f.WriteAt([]byte("AB"), 8)
+	check("writeat", err)
+	n, err = f.ReadAt(buf, 7)
+	log("readat: %d %q %v", n, buf[:n], err)
+	_, err = f.Seek(0, io.SeekEnd)
+	check("seek end", err)
+	n, err = f.Read(buf)
+	log("read at end: %d %v", n, err)
+	_, err = f.WriteAt([]byte("!"), 12)
+	check("write past end", err)
+	fi, err := f.Stat()
+	check("fstat", err)
+	log("size: %d, dir: %v, regular: %v", fi.Size(), fi.IsDir(), fi.Mode().IsRegular())
+	check("truncate open file", f.Truncate(4))
+	check("sync", f.Sync())
+	check("close rw", f.Close())
+	data, _ = os.ReadFile(p("rw.bin"))
+	log("contents: %q", data)
+
+	check("truncate grow", os.Truncate(p("rw.bin"), 6))
+	data, _ = os.ReadFile(p("rw.bin"))
+	log("contents: %q", data)
+	check("truncate missing", os.Truncate(p("missing"), 0))
+	check("truncate dir", os.Truncate(p("a"), 0))
+
+	fi, err = os.Stat(p("a"))
+	check("stat dir", err)
+	log("name: %s, dir: %v", fi.Name(), fi.IsDir())
+	fi, err = os.Lstat(p("hello.txt"))
+	check("lstat", err)
+	log("name: %s, size: %d", fi.Name(), fi.Size())
+	_, err = os.Stat(p("missing"))
+	check("stat missing", err)
+
+	check("chmod", os.Chmod(p("hello.txt"), 0600))
+	fi, _ = os.Stat(p("hello.txt"))
+	log("mode: %v", fi.Mode())
+
+	check("writefile dir", os.WriteFile(p("a"), nil, 0644))
+	_, err = os.ReadFile(p("a"))
+	check("readfile dir", err)
+
+	entries, err := os.ReadDir(base)
+	check("readdir", err)
+	for _, e := range entries {
+		log("entry: %s dir=%v", e.Name(), e.IsDir())
+	}
+	_, err = os.ReadDir(p("hello.txt"))
+	check("readdir file", err)
+
+	check("rename", os.Rename(p("rw.bin"), p("a/moved.bin")))
+	_, err = os.Stat(p("rw.bin"))
+	check("stat old name", err)
+	fi, err = os.Stat(p("a/moved.bin"))
+	check("stat new name", err)
+	check("rename over file", os.Rename(p("hello.txt"), p("a/moved.bin")))
+	check("rename file over dir", os.Rename(p("a/moved.bin"), p("a/b")))
+	check("rename dir over file", os.Rename(p("a/b"), p("a/moved.bin")))
+	check("rename dir into itself", os.Rename(p("a"), p("a/b/c/d")))
+	check("rename missing", os.Rename(p("missing"), p("other")))
+	check("rename dir", os.Rename(p("a/b"), p("b")))
+
+	check("rmdir not empty", syscall.Rmdir(p("b")))
+	check("rmdir file", syscall.Rmdir(p("a/moved.bin")))
+	check("unlink dir", syscall.Unlink(p("b")))
+	check("unlink missing", syscall.Unlink(p("missing")))
+	check("remove file", os.Remove(p("a/moved.bin")))
+	check("remove dir", os.Remove(p("a")))
+	check("remove not empty", os.Remove(p("b")))
+	check("removeall", os.RemoveAll(base))
+	_, err = os.Stat(base)
+	log("gone: %v", os.IsNotExist(err))
+}
@@ -0,0 +1,96 @@
+// Command hostfs tries to read, write and escape the host directories mounted
+// at /data and, read-only, at /ro, and logs what it observes with
+// console.log.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// check logs the result of op with the name of its errno, if any.
+func check(op string, err error) {
+	var errno syscall.Errno
+	switch {
+	case err == nil:
+		log("%s: ok", op)
+	case errors.As(err, &errno):
+		log("%s: %v", op, errno)
+	default:
+		log("%s: %v", op, err)
+	}
+}
+
+func read(name string) {
+	data, err := os.ReadFile(name)
+	if err == nil {
+		log("read %s: %q", name, data)
+		return
+	}
+	check("read "+name, err)
+}
+
+func main() {
+	read("/data/hello.txt")
+	read("/data/inside/inner.txt")
+	read("/data/rel")
+	read("/data/../secret.txt")
+	read("/data/sub/../../../secret.txt")
+	read("/data/escape")
+	read("/data/up")
+	read("/data/up/secret.txt")
+	read("/data/loop")
+
+	_, err := os.Stat("/data/escape")
+	check("stat escape", err)
+	fi, err := os.Lstat("/data/escape")
+	check("lstat escape", err)
+	if err == nil {
+		log("escape is a link: %v", fi.Mode()&os.ModeSymlink != 0)
+	}
+
+	check("symlink out", os.Symlink("/etc/passwd", "/data/mine"))
+	read("/data/mine")
+
+	check("write", os.WriteFile("/data/new.txt", []byte("written by the guest\n"), 0644))
+	read("/data/new.txt")
+
+	read("/ro/readme")
+	check("write read-only", os.WriteFile("/ro/new.txt", nil, 0644))
+	check("remove read-only", os.Remove("/ro/readme"))
+	check("mkdir read-only", os.Mkdir("/ro/dir", 0755))
+	check("rename across mounts", os.Rename("/data/hello.txt", "/ro/hello.txt"))
+	check("remove mount point", syscall.Rmdir("/data"))
+
+	entries, err := os.ReadDir("/")
+	check("readdir /", err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	log("entries: %s", strings.Join(names, " "))
+
+	// Links lead to other mounts, and absolute targets name files of the
+	// guest wherever the link is.
+	check("symlink into mount", os.Symlink("/data/hello.txt", "/hello"))
+	read("/hello")
+	check("symlink to mount", os.Symlink("/data", "/datalink"))
+	read("/datalink/sub/inner.txt")
+	check("symlink relative", os.Symlink("ro/readme", "/readme"))
+	read("/readme")
+	check("symlink absolute", os.Symlink("/data/hello.txt", "/data/abs"))
+	read("/data/abs")
+	target, err := os.Readlink("/data/abs")
+	check("readlink /data/abs", err)
+	log("target: %s", target)
+}
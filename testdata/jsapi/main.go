@@ -0,0 +1,131 @@
+// Command jsapi exercises the syscall/js API and logs what it observes with
+// console.log, so its output can be compared with the one under Node.js.
+package main
+
+import (
+	"fmt"
+	"math"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// try runs f and logs the JavaScript exception or the panic it raises, if
+// any.
+func try(name string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(js.Error); ok {
+				log("%s: threw, instanceof Error: %v", name, err.Value.InstanceOf(js.Global().Get("Error")))
+				return
+			}
+			log("%s: panicked: %v", name, r)
+		}
+	}()
+	f()
+	log("%s: did not throw", name)
+}
+
+func describe(name string, v js.Value) {
+	log("%s: type=%s truthy=%v string=%s", name, v.Type(), v.Truthy(), v.String())
+}
+
+func main() {
+	global := js.Global()
+	Object := global.Get("Object")
+	Error := global.Get("Error")
+	Uint8Array := global.Get("Uint8Array")
+
+	// Types and conversions.
+	describe("undefined", js.Undefined())
+	describe("null", js.Null())
+	describe("true", js.ValueOf(true))
+	describe("false", js.ValueOf(false))
+	describe("zero", js.ValueOf(0))
+	describe("int", js.ValueOf(42))
+	describe("negative", js.ValueOf(-7))
+	describe("float", js.ValueOf(1.5))
+	describe("large", js.ValueOf(1e21))
+	describe("small", js.ValueOf(1.5e-7))
+	describe("nan", js.ValueOf(math.NaN()))
+	describe("inf", js.ValueOf(math.Inf(-1)))
+	describe("empty string", js.ValueOf(""))
+	describe("string", js.ValueOf("héllo, 世界"))
+	describe("object", Object.New())
+	describe("function", js.FuncOf(func(js.Value, []js.Value) interface{} { return nil }).Value)
+
+	log("int: %d float: %v bool: %v", js.ValueOf(42).Int(), js.ValueOf(1.5).Float(), js.ValueOf(true).Bool())
+	log("isNaN: %v %v", js.ValueOf(math.NaN()).IsNaN(), js.ValueOf(1).IsNaN())
+	log("isNull: %v %v", js.Null().IsNull(), js.Undefined().IsNull())
+	log("isUndefined: %v %v", js.Undefined().IsUndefined(), js.Null().IsUndefined())
+	log("equal: %v %v %v", js.ValueOf(1).Equal(js.ValueOf(1)), js.ValueOf("a").Equal(js.ValueOf("b")), global.Equal(js.Global()))
+
+	// Properties.
+	obj := Object.New()
+	obj.Set("answer", 42)
+	obj.Set("name", "gopher")
+	obj.Set("nested", map[string]interface{}{"ok": true})
+	log("get: %d %s %v", obj.Get("answer").Int(), obj.Get("name").String(), obj.Get("nested").Get("ok").Bool())
+	log("missing: %s", obj.Get("missing").Type())
+	obj.Delete("answer")
+	log("deleted: %s", obj.Get("answer").Type())
+	obj.Set("name", js.Null())
+	log("set null: %s", obj.Get("name").Type())
+	obj.Set("name", js.Undefined())
+	log("set undefined: %s", obj.Get("name").Type())
+
+	// instanceof.
+	err := Error.New("boom")
+	log("error message: %s", err.Get("message").String())
+	log("instanceof: %v %v %v", err.InstanceOf(Error), obj.InstanceOf(Error), obj.InstanceOf(Object))
+	log("error: %s", js.Error{Value: err}.Error())
+
+	// Calls into Go functions.
+	add := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		sum := 0
+		for _, a := range args {
+			sum += a.Int()
+		}
+		return sum
+	})
+	defer add.Release()
+	obj.Set("add", add)
+	log("call: %d", obj.Call("add", 1, 2, 3).Int())
+	log("invoke: %d", add.Invoke(4, 5).Int())
+	log("invoke value: %d", obj.Get("add").Invoke(6).Int())
+
+	self := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return this
+	})
+	defer self.Release()
+	obj.Set("self", self)
+	log("this: %v", obj.Call("self").Equal(obj))
+
+	nested := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		return obj.Call("add", args[0], 1).Int() * 2
+	})
+	defer nested.Release()
+	log("nested: %d", nested.Invoke(20).Int())
+
+	try("call missing", func() { obj.Call("missing") })
+	try("invoke object", func() { obj.Invoke() })
+	try("new object", func() { obj.New() })
+	try("call ok", func() { obj.Call("add") })
+	try("call class", func() { global.Call("Uint8Array", 1) })
+	try("invoke class", func() { Uint8Array.Invoke(1) })
+	try("new bad length", func() { Uint8Array.New(-1) })
+	describe("class", Uint8Array)
+
+	// Bytes.
+	buf := Uint8Array.New(4)
+	n := js.CopyBytesToJS(buf, []byte{1, 2, 3, 4, 5})
+	dst := make([]byte, 8)
+	m := js.CopyBytesToGo(dst, buf)
+	log("bytes: %d %d %v", n, m, dst)
+
+	log("done")
+}
@@ -0,0 +1,52 @@
+// Command jsobject uses the host objects store, an instance of Store, and
+// logs what it observes with console.log.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall/js"
+)
+
+var (
+	global  = js.Global()
+	console = global.Get("console")
+)
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func objectKeys(v js.Value) string {
+	keys := global.Get("Object").Call("keys", v)
+	names := make([]string, keys.Length())
+	for i := range names {
+		names[i] = keys.Index(i).String()
+	}
+	return strings.Join(names, ",")
+}
+
+func main() {
+	store := global.Get("store")
+
+	log("get: %s %s", store.Get("name").String(), store.Get("missing").Type())
+	store.Set("answer", 42)
+	log("set: %d", store.Get("answer").Int())
+	store.Delete("name")
+	log("delete: %s", store.Get("name").Type())
+	log("keys: %s", objectKeys(store))
+
+	log("call: %d", store.Call("sum", 1, 2, 3).Int())
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log("call missing: %v", r)
+			}
+		}()
+		store.Call("missing")
+	}()
+
+	store.SetIndex(1, "second")
+	log("index: %s %s length %d", store.Index(1).String(), store.Index(9).Type(), store.Length())
+	log("instanceof: %v %v", store.InstanceOf(global.Get("Store")), store.InstanceOf(global.Get("Object")))
+}
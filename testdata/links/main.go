@@ -0,0 +1,162 @@
+// Command links exercises hard and symbolic links through the os package and
+// logs what it observes with console.log. Like testdata/fs, it works in the
+// directory given as its argument, /linktest by default, which must not exist
+// yet.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+var base = "/linktest"
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// p returns the path of name in the working directory.
+func p(name string) string {
+	return base + "/" + name
+}
+
+// check logs the result of op, without the working directory in errors.
+func check(op string, err error) {
+	if err == nil {
+		log("%s: ok", op)
+		return
+	}
+
+	msg := strings.ReplaceAll(err.Error(), base, "$BASE")
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		log("%s: %s (errno %d)", op, msg, int(errno))
+		return
+	}
+	log("%s: %s", op, msg)
+}
+
+// read logs the contents of name.
+func read(name string) {
+	data, err := os.ReadFile(p(name))
+	if err != nil {
+		check("read "+name, err)
+		return
+	}
+	log("read %s: %q", name, data)
+}
+
+// stat logs what stat or lstat tell about name.
+func stat(name string, follow bool) {
+	op, f := "lstat", os.Lstat
+	if follow {
+		op, f = "stat", os.Stat
+	}
+
+	fi, err := f(p(name))
+	if err != nil {
+		check(op+" "+name, err)
+		return
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	if fi.IsDir() {
+		// The size of directories depends on the filesystem.
+		log("%s %s: %v nlink %d", op, name, fi.Mode(), st.Nlink)
+		return
+	}
+	log("%s %s: %v size %d nlink %d", op, name, fi.Mode(), fi.Size(), st.Nlink)
+}
+
+// readlink logs the target of name.
+func readlink(name string) {
+	target, err := os.Readlink(p(name))
+	if err != nil {
+		check("readlink "+name, err)
+		return
+	}
+	log("readlink %s: %s", name, strings.ReplaceAll(target, base, "$BASE"))
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		base = os.Args[1]
+	}
+
+	check("mkdir base", os.Mkdir(base, 0755))
+	check("mkdir dir", os.Mkdir(p("dir"), 0755))
+	check("write target", os.WriteFile(p("target.txt"), []byte("target\n"), 0644))
+	check("write inner", os.WriteFile(p("dir/inner.txt"), []byte("inner\n"), 0644))
+
+	// Hard links share the file.
+	check("link", os.Link(p("target.txt"), p("hard.txt")))
+	stat("target.txt", true)
+	stat("hard.txt", true)
+	check("write through hard link", os.WriteFile(p("hard.txt"), []byte("changed\n"), 0644))
+	read("target.txt")
+	check("link existing", os.Link(p("target.txt"), p("hard.txt")))
+	check("link directory", os.Link(p("dir"), p("dirlink")))
+	check("link missing", os.Link(p("missing"), p("new")))
+
+	// Symbolic links are followed by stat, but not lstat.
+	check("symlink", os.Symlink("target.txt", p("sym.txt")))
+	readlink("sym.txt")
+	stat("sym.txt", false)
+	stat("sym.txt", true)
+	read("sym.txt")
+	readlink("target.txt")
+	check("symlink existing", os.Symlink("target.txt", p("sym.txt")))
+
+	check("symlink dir", os.Symlink("dir", p("dirsym")))
+	read("dirsym/inner.txt")
+	entries, err := os.ReadDir(p("dirsym"))
+	check("readdir through link", err)
+	for _, e := range entries {
+		log("entry: %s", e.Name())
+	}
+	check("symlink up", os.Symlink("../target.txt", p("dir/up")))
+	read("dir/up")
+	check("symlink absolute", os.Symlink(p("dir/inner.txt"), p("abs")))
+	readlink("abs")
+	read("abs")
+
+	// A dangling link can be created, and writing through it creates its
+	// target.
+	check("symlink dangling", os.Symlink("later.txt", p("dangling")))
+	stat("dangling", true)
+	stat("dangling", false)
+	check("write through dangling link", os.WriteFile(p("dangling"), []byte("later\n"), 0644))
+	read("later.txt")
+
+	check("symlink loop a", os.Symlink("loop-b", p("loop-a")))
+	check("symlink loop b", os.Symlink("loop-a", p("loop-b")))
+	stat("loop-a", true)
+	stat("loop-a", false)
+	read("loop-a")
+	check("symlink self", os.Symlink("self/x", p("self")))
+	read("self")
+
+	// Removing a link leaves the file; removing the file leaves the links.
+	check("remove sym", os.Remove(p("sym.txt")))
+	read("target.txt")
+	check("remove target", os.Remove(p("target.txt")))
+	stat("hard.txt", true)
+	read("hard.txt")
+	read("dir/up")
+	check("rename onto hard link of itself", os.Link(p("hard.txt"), p("hard2.txt")))
+	check("rename", os.Rename(p("hard.txt"), p("hard2.txt")))
+	stat("hard.txt", true)
+	stat("hard2.txt", true)
+	check("rename link", os.Rename(p("dirsym"), p("dirsym2")))
+	read("dirsym2/inner.txt")
+	stat("dir", true)
+
+	check("removeall", os.RemoveAll(base))
+	_, err = os.Lstat(base)
+	log("gone: %v", os.IsNotExist(err))
+}
@@ -0,0 +1,29 @@
+// Command output writes to its standard output and error, through the fs
+// module and the runtime's own writes, for the tests to check they come out
+// byte for byte.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lines" {
+		fmt.Print("one\ntwo\n")
+		fmt.Fprint(os.Stderr, "warning\n")
+		fmt.Print("\xff\xfe\n")
+		fmt.Print("last without newline")
+		return
+	}
+
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	os.Stdout.Write(all)
+	fmt.Print("no newline")
+
+	fmt.Fprint(os.Stderr, "to stderr\n")
+	println("from the runtime")
+}
@@ -0,0 +1,88 @@
+// Command perms runs as an unprivileged user on the tree the host prepares,
+// and logs what it is allowed to do with console.log.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"syscall/js"
+	"time"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// check logs the result of op with the name of its errno, if any.
+func check(op string, err error) {
+	var errno syscall.Errno
+	switch {
+	case err == nil:
+		log("%s: ok", op)
+	case errors.As(err, &errno):
+		log("%s: %v", op, errno)
+	default:
+		log("%s: %v", op, err)
+	}
+}
+
+// owner logs the mode and owner of name.
+func owner(name string) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		check("stat "+name, err)
+		return
+	}
+	st := fi.Sys().(*syscall.Stat_t)
+	log("%s: %v %d:%d", name, fi.Mode(), st.Uid, st.Gid)
+}
+
+func main() {
+	groups, err := os.Getgroups()
+	log("uid %d gid %d euid %d egid %d groups %v %v",
+		os.Getuid(), os.Getgid(), os.Geteuid(), os.Getegid(), groups, err)
+
+	_, err = os.ReadFile("/root/secret")
+	check("read /root/secret", err)
+	_, err = os.ReadDir("/root")
+	check("readdir /root", err)
+	_, err = os.Stat("/root/secret")
+	check("stat /root/secret", err)
+
+	_, err = os.ReadFile("/etc/conf")
+	check("read /etc/conf", err)
+	check("write /etc/conf", os.WriteFile("/etc/conf", nil, 0644))
+	check("chmod /etc/conf", os.Chmod("/etc/conf", 0666))
+	check("chown /etc/conf", os.Chown("/etc/conf", 1000, 1000))
+	check("chtimes /etc/conf", os.Chtimes("/etc/conf", time.Now(), time.Now()))
+	check("create in /etc", os.WriteFile("/etc/mine", nil, 0644))
+	check("remove /etc/conf", os.Remove("/etc/conf"))
+
+	check("create in /shared", os.WriteFile("/shared/new.txt", []byte("new\n"), 0666))
+	owner("/shared/new.txt")
+	check("chmod own file", os.Chmod("/shared/new.txt", 0640))
+	check("chown own file to a group of mine", os.Chown("/shared/new.txt", -1, 100))
+	check("chown own file to a foreign group", os.Chown("/shared/new.txt", -1, 0))
+	check("chown own file to root", os.Chown("/shared/new.txt", 0, -1))
+	check("chtimes own file", os.Chtimes("/shared/new.txt", time.Unix(1, 0), time.Unix(2, 0)))
+	owner("/shared/new.txt")
+
+	f, err := os.Open("/shared/new.txt")
+	if err == nil {
+		check("fchmod read-only file", f.Chmod(0600))
+		f.Close()
+	}
+
+	log("umask: %#o", syscall.Umask(077))
+	check("mkdir with umask 077", os.Mkdir("/shared/private", 0777))
+	owner("/shared/private")
+	log("umask: %#o", syscall.Umask(022))
+
+	check("remove foreign file in /tmp", os.Remove("/tmp/other"))
+	check("create in /tmp", os.WriteFile("/tmp/mine", nil, 0600))
+	check("remove own file in /tmp", os.Remove("/tmp/mine"))
+}
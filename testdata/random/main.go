@@ -0,0 +1,16 @@
+// Command random reads from crypto/rand, past the 64 KiB crypto.getRandomValues
+// fills at once, and logs with console.log how many bytes it got and the first
+// and last of them.
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"syscall/js"
+)
+
+func main() {
+	b := make([]byte, 100000)
+	n, err := rand.Read(b)
+	js.Global().Get("console").Call("log", fmt.Sprintf("read %d %v: %x %x", n, err, b[:8], b[len(b)-8:]))
+}
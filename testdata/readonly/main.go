@@ -0,0 +1,76 @@
+// Command readonly reads the same files from the read-only filesystems
+// mounted at /embed, /zip and /tar, and logs what it observes with
+// console.log.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"syscall/js"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+// check logs the result of op with the name of its errno, if any.
+func check(op string, err error) {
+	var errno syscall.Errno
+	switch {
+	case err == nil:
+		log("%s: ok", op)
+	case errors.As(err, &errno):
+		log("%s: %v", op, errno)
+	default:
+		log("%s: %v", op, err)
+	}
+}
+
+func main() {
+	for _, dir := range []string{"/embed", "/zip", "/tar"} {
+		data, err := os.ReadFile(dir + "/hello.txt")
+		check(dir+" readfile", err)
+		log("contents: %q", data)
+
+		f, err := os.Open(dir + "/hello.txt")
+		check(dir+" open", err)
+		buf := make([]byte, 6)
+		n, err := f.ReadAt(buf, 7)
+		log("readat 7: %q %v", buf[:n], err)
+		n, err = f.ReadAt(buf, 0)
+		log("readat 0: %q %v", buf[:n], err)
+		_, err = f.Write([]byte("x"))
+		check(dir+" write", err)
+		check(dir+" close", f.Close())
+
+		entries, err := os.ReadDir(dir)
+		check(dir+" readdir", err)
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, fmt.Sprintf("%s(dir=%v)", e.Name(), e.IsDir()))
+		}
+		log("entries: %s", strings.Join(names, " "))
+
+		fi, err := os.Stat(dir + "/sub/data.txt")
+		check(dir+" stat", err)
+		if err == nil {
+			log("size: %d", fi.Size())
+		}
+
+		_, err = os.ReadFile(dir + "/missing")
+		log("missing: %v", os.IsNotExist(err))
+		check(dir+" create", os.WriteFile(dir+"/new.txt", nil, 0644))
+		check(dir+" open for writing", func() error {
+			_, err := os.OpenFile(dir+"/hello.txt", os.O_WRONLY, 0)
+			return err
+		}())
+		check(dir+" remove", os.Remove(dir+"/hello.txt"))
+		check(dir+" mkdir", os.Mkdir(dir+"/dir", 0755))
+		check(dir+" chmod", os.Chmod(dir+"/hello.txt", 0600))
+	}
+}
@@ -0,0 +1,37 @@
+// Command stdin echoes the lines of its standard input with console.log,
+// while a timer shows that the guest keeps running as it waits for them.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"syscall/js"
+	"time"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "timer" {
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			log("timer fired")
+		}()
+	}
+
+	s := bufio.NewScanner(os.Stdin)
+	lines := 0
+	for s.Scan() {
+		lines++
+		log("line %d: %s", lines, s.Text())
+	}
+	log("done: %d lines, %v", lines, s.Err())
+
+	_, err := os.Stdin.Write([]byte("x"))
+	log("write stdin: %v", err != nil)
+}
@@ -0,0 +1,53 @@
+// Command structs uses the host structs user, a pointer, and frozen, a
+// value, and logs what it observes with console.log.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall/js"
+)
+
+var (
+	global  = js.Global()
+	console = global.Get("console")
+)
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func show(v js.Value) string {
+	if v.Type() == js.TypeString {
+		return v.String()
+	}
+	return v.Type().String()
+}
+
+func main() {
+	user := global.Get("user")
+
+	for _, key := range []string{"name", "mail", "email", "password", "secret", "urlPath", "createdBy", "Name", "extraNote"} {
+		log("%s: %s", key, show(user.Get(key)))
+	}
+	log("location: %v,%v", user.Get("location").Get("x").Float(), user.Get("location").Get("y").Float())
+
+	user.Set("name", "Rob")
+	user.Get("location").Set("x", 3)
+	user.Set("mail", 42)
+	log("after set: %s %v %s", user.Get("name").String(), user.Get("location").Get("x").Float(), user.Get("mail").String())
+
+	log("greet: %s", user.Call("greet", "Hello").String())
+	log("initials: %s", user.Call("initials").String())
+
+	keys := global.Get("Object").Call("keys", user)
+	names := make([]string, keys.Length())
+	for i := range names {
+		names[i] = keys.Index(i).String()
+	}
+	log("keys: %s", strings.Join(names, ","))
+
+	frozen := global.Get("frozen")
+	frozen.Set("name", "changed")
+	log("frozen: %s %s", frozen.Get("name").String(), frozen.Call("initials").String())
+}
@@ -0,0 +1,35 @@
+// Command timers sleeps, waits on a timer and stops another one, logging each
+// step with console.log, then blocks forever so the runtime reports a
+// deadlock.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+	"time"
+)
+
+var console = js.Global().Get("console")
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func main() {
+	log("start")
+	stopped := time.AfterFunc(time.Hour, func() { log("stopped timer fired") })
+
+	done := make(chan struct{})
+	go func() {
+		<-time.After(20 * time.Millisecond)
+		log("after 20ms")
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	log("slept 10ms")
+	<-done
+	log("stopped: %v", stopped.Stop())
+
+	select {}
+}
@@ -0,0 +1,129 @@
+// Command typedarrays exercises ArrayBuffer, DataView and the typed arrays
+// through syscall/js and logs what it observes with console.log.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+var (
+	global  = js.Global()
+	console = global.Get("console")
+)
+
+func log(format string, args ...interface{}) {
+	console.Call("log", fmt.Sprintf(format, args...))
+}
+
+func elements(a js.Value) []float64 {
+	values := make([]float64, a.Length())
+	for i := range values {
+		values[i] = a.Index(i).Float()
+	}
+	return values
+}
+
+func dump(name string, a js.Value) {
+	log("%s: length=%d byteOffset=%d byteLength=%d %v", name,
+		a.Length(), a.Get("byteOffset").Int(), a.Get("byteLength").Int(), elements(a))
+}
+
+func try(name string, f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(js.Error); ok {
+				log("%s: threw", name)
+				return
+			}
+			log("%s: panicked: %v", name, r)
+		}
+	}()
+	f()
+	log("%s: did not throw", name)
+}
+
+func main() {
+	ArrayBuffer := global.Get("ArrayBuffer")
+	DataView := global.Get("DataView")
+
+	buf := ArrayBuffer.New(16)
+	log("buffer: byteLength=%d", buf.Get("byteLength").Int())
+
+	u8 := global.Get("Uint8Array").New(buf)
+	i32 := global.Get("Int32Array").New(buf, 4, 2)
+	f64 := global.Get("Float64Array").New(buf, 8)
+	dump("u8", u8)
+	dump("i32", i32)
+
+	i32.SetIndex(0, -2)
+	i32.SetIndex(1, 1<<31)
+	i32.SetIndex(5, 7)
+	dump("i32 after set", i32)
+	dump("u8 shares", u8)
+
+	f64.SetIndex(0, 1.5)
+	dump("f64", f64)
+	log("same buffer: %v", f64.Get("buffer").Equal(buf))
+
+	for _, name := range []string{"Int8Array", "Uint8Array", "Uint8ClampedArray", "Int16Array", "Uint16Array", "Uint32Array", "Float32Array"} {
+		a := global.Get(name).New(4)
+		a.SetIndex(0, -1)
+		a.SetIndex(1, 300.7)
+		a.SetIndex(2, 2.5)
+		a.SetIndex(3, "12")
+		log("%s: %v bytes per element %d", name, elements(a), global.Get(name).Get("BYTES_PER_ELEMENT").Int())
+	}
+
+	// subarray and set.
+	src := js.ValueOf([]interface{}{1, 2, 3, 4, 5, 6})
+	a := global.Get("Uint8Array").New(src)
+	sub := a.Call("subarray", 1, -2)
+	dump("subarray", sub)
+	sub.SetIndex(0, 20)
+	dump("parent", a)
+	dump("subarray(-2)", a.Call("subarray", -2))
+	dump("subarray(4, 1)", a.Call("subarray", 4, 1))
+	a.Call("set", js.ValueOf([]interface{}{7, 8}), 4)
+	dump("set array", a)
+	a.Call("set", a.Call("subarray", 0, 3), 1)
+	dump("set overlapping", a)
+	try("set out of bounds", func() { a.Call("set", js.ValueOf([]interface{}{1, 2}), 5) })
+
+	// Copies.
+	c := global.Get("Int16Array").New(a)
+	c.SetIndex(0, 1000)
+	dump("copy", c)
+	dump("original", a)
+	sliced := buf.Call("slice", 4, 8)
+	log("buffer slice: %d", sliced.Get("byteLength").Int())
+
+	// DataView.
+	view := DataView.New(buf, 2, 8)
+	view.Call("setUint16", 0, 0x1234)
+	view.Call("setUint16", 2, 0x1234, true)
+	view.Call("setFloat32", 4, 2.5)
+	log("view: byteOffset=%d byteLength=%d", view.Get("byteOffset").Int(), view.Get("byteLength").Int())
+	log("getUint16: %#x %#x %#x", view.Call("getUint16", 0).Int(), view.Call("getUint16", 0, true).Int(), view.Call("getUint16", 2, true).Int())
+	log("getInt8: %d getFloat32: %v", view.Call("getInt8", 0).Int(), view.Call("getFloat32", 4).Float())
+	dump("bytes", global.Get("Uint8Array").New(buf, 0, 10))
+	try("getInt32 out of bounds", func() { view.Call("getInt32", 6) })
+
+	// Byte copies work with any Uint8Array view.
+	window := global.Get("Uint8Array").New(buf, 10, 4)
+	n := js.CopyBytesToJS(window, []byte{9, 8, 7, 6, 5})
+	got := make([]byte, 3)
+	m := js.CopyBytesToGo(got, window.Call("subarray", 1))
+	log("copy bytes: %d %d %v", n, m, got)
+	clamped := global.Get("Uint8ClampedArray").New(2)
+	log("clamped copy: %d", js.CopyBytesToJS(clamped, []byte{1, 2, 3}))
+
+	log("instanceof: %v %v %v", u8.InstanceOf(global.Get("Uint8Array")), i32.InstanceOf(global.Get("Uint8Array")), buf.InstanceOf(ArrayBuffer))
+
+	try("bad length", func() { global.Get("Uint8Array").New(-1) })
+	try("misaligned", func() { global.Get("Int32Array").New(buf, 2) })
+	try("odd buffer", func() { global.Get("Int32Array").New(ArrayBuffer.New(6)) })
+	try("view past end", func() { DataView.New(buf, 20) })
+
+	log("done")
+}
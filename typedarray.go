@@ -0,0 +1,503 @@
+package wasmvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ArrayBuffer is a JavaScript ArrayBuffer, a block of bytes accessed through
+// typed arrays and DataViews.
+type ArrayBuffer struct {
+	data []byte
+}
+
+// NewArrayBuffer returns an ArrayBuffer backed by data.
+func NewArrayBuffer(data []byte) *ArrayBuffer {
+	return &ArrayBuffer{data: data}
+}
+
+// Bytes returns the contents of b. They are shared with the guest.
+func (b *ArrayBuffer) Bytes() []byte {
+	return b.data
+}
+
+func (b *ArrayBuffer) get(key string) interface{} {
+	switch key {
+	case "byteLength":
+		return len(b.data)
+	case "slice":
+		return func(begin, end interface{}) *ArrayBuffer {
+			from, to := relativeRange(begin, end, len(b.data))
+			return &ArrayBuffer{data: append([]byte{}, b.data[from:to]...)}
+		}
+	}
+
+	return Undefined
+}
+
+// elementKind describes the element type of a typed array or of a DataView
+// accessor, such as Int32 or Float64.
+type elementKind struct {
+	name string
+	size int
+	get  func(b []byte, order binary.ByteOrder) float64
+	set  func(b []byte, order binary.ByteOrder, v float64)
+}
+
+var elementKinds = []*elementKind{
+	{
+		name: "Int8", size: 1,
+		get: func(b []byte, _ binary.ByteOrder) float64 { return float64(int8(b[0])) },
+		set: func(b []byte, _ binary.ByteOrder, v float64) { b[0] = byte(toUint32(v)) },
+	},
+	{
+		name: "Uint8", size: 1,
+		get: func(b []byte, _ binary.ByteOrder) float64 { return float64(b[0]) },
+		set: func(b []byte, _ binary.ByteOrder, v float64) { b[0] = byte(toUint32(v)) },
+	},
+	{
+		name: "Uint8Clamped", size: 1,
+		get: func(b []byte, _ binary.ByteOrder) float64 { return float64(b[0]) },
+		set: func(b []byte, _ binary.ByteOrder, v float64) {
+			switch {
+			case math.IsNaN(v) || v <= 0:
+				b[0] = 0
+			case v >= 255:
+				b[0] = 255
+			default:
+				b[0] = byte(math.RoundToEven(v))
+			}
+		},
+	},
+	{
+		name: "Int16", size: 2,
+		get: func(b []byte, o binary.ByteOrder) float64 { return float64(int16(o.Uint16(b))) },
+		set: func(b []byte, o binary.ByteOrder, v float64) { o.PutUint16(b, uint16(toUint32(v))) },
+	},
+	{
+		name: "Uint16", size: 2,
+		get: func(b []byte, o binary.ByteOrder) float64 { return float64(o.Uint16(b)) },
+		set: func(b []byte, o binary.ByteOrder, v float64) { o.PutUint16(b, uint16(toUint32(v))) },
+	},
+	{
+		name: "Int32", size: 4,
+		get: func(b []byte, o binary.ByteOrder) float64 { return float64(int32(o.Uint32(b))) },
+		set: func(b []byte, o binary.ByteOrder, v float64) { o.PutUint32(b, toUint32(v)) },
+	},
+	{
+		name: "Uint32", size: 4,
+		get: func(b []byte, o binary.ByteOrder) float64 { return float64(o.Uint32(b)) },
+		set: func(b []byte, o binary.ByteOrder, v float64) { o.PutUint32(b, toUint32(v)) },
+	},
+	{
+		name: "Float32", size: 4,
+		get: func(b []byte, o binary.ByteOrder) float64 { return float64(math.Float32frombits(o.Uint32(b))) },
+		set: func(b []byte, o binary.ByteOrder, v float64) { o.PutUint32(b, math.Float32bits(float32(v))) },
+	},
+	{
+		name: "Float64", size: 8,
+		get: func(b []byte, o binary.ByteOrder) float64 { return math.Float64frombits(o.Uint64(b)) },
+		set: func(b []byte, o binary.ByteOrder, v float64) { o.PutUint64(b, math.Float64bits(v)) },
+	},
+}
+
+// toUint32 converts v to an integer modulo 2^32, like the integer typed
+// arrays do before storing it.
+func toUint32(v float64) uint32 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+
+	m := math.Mod(math.Trunc(v), 1<<32)
+	if m < 0 {
+		m += 1 << 32
+	}
+
+	return uint32(m)
+}
+
+// TypedArray is a view of an ArrayBuffer as an array of numbers, such as a
+// Uint8Array or a Float64Array.
+type TypedArray struct {
+	kind   *elementKind
+	buffer *ArrayBuffer
+	offset int
+	length int
+}
+
+// NewUint8Array returns a Uint8Array over data.
+func NewUint8Array(data []byte) *TypedArray {
+	return &TypedArray{
+		kind:   elementKindByName("Uint8"),
+		buffer: NewArrayBuffer(data),
+		length: len(data),
+	}
+}
+
+func elementKindByName(name string) *elementKind {
+	for _, k := range elementKinds {
+		if k.name == name {
+			return k
+		}
+	}
+	return nil
+}
+
+// Type returns the class name of a, such as "Int32Array".
+func (a *TypedArray) Type() string {
+	return a.kind.name + "Array"
+}
+
+// Bytes returns the part of the buffer a gives access to. It is shared with
+// the guest.
+func (a *TypedArray) Bytes() []byte {
+	return a.buffer.data[a.offset : a.offset+a.length*a.kind.size]
+}
+
+// Len returns the number of elements of a.
+func (a *TypedArray) Len() int {
+	return a.length
+}
+
+// isBytes reports whether a is a Uint8Array or a Uint8ClampedArray, the
+// views the js.CopyBytesTo* functions accept.
+func (a *TypedArray) isBytes() bool {
+	return a.kind.name == "Uint8" || a.kind.name == "Uint8Clamped"
+}
+
+func (a *TypedArray) at(i int) float64 {
+	off := a.offset + i*a.kind.size
+	return a.kind.get(a.buffer.data[off:off+a.kind.size], binary.LittleEndian)
+}
+
+func (a *TypedArray) setAt(i int, v float64) {
+	off := a.offset + i*a.kind.size
+	a.kind.set(a.buffer.data[off:off+a.kind.size], binary.LittleEndian, v)
+}
+
+func (a *TypedArray) index(i int) interface{} {
+	if i < 0 || i >= a.length {
+		return Undefined
+	}
+	return a.at(i)
+}
+
+// setIndex stores x at i. Like in JavaScript, indexes out of range are
+// ignored.
+func (a *TypedArray) setIndex(i int, x interface{}) {
+	if i >= 0 && i < a.length {
+		a.setAt(i, toNumber(x))
+	}
+}
+
+func (a *TypedArray) get(key string) interface{} {
+	switch key {
+	case "length":
+		return a.length
+	case "byteLength":
+		return a.length * a.kind.size
+	case "byteOffset":
+		return a.offset
+	case "buffer":
+		return a.buffer
+	case "BYTES_PER_ELEMENT":
+		return a.kind.size
+	case "subarray":
+		return a.subarray
+	case "set":
+		return a.set
+	}
+
+	return Undefined
+}
+
+// subarray returns a view of the elements of a from begin to end, sharing
+// its buffer. Negative indexes count from the end.
+func (a *TypedArray) subarray(begin, end interface{}) *TypedArray {
+	from, to := relativeRange(begin, end, a.length)
+
+	return &TypedArray{
+		kind:   a.kind,
+		buffer: a.buffer,
+		offset: a.offset + from*a.kind.size,
+		length: to - from,
+	}
+}
+
+// set copies the elements of src, an array or a typed array, into a starting
+// at element offset.
+func (a *TypedArray) set(src interface{}, offset interface{}) error {
+	start := 0
+	if offset != Undefined {
+		start = int(math.Trunc(toNumber(offset)))
+		if start < 0 {
+			return &Error{Message: "offset is out of bounds"}
+		}
+	}
+
+	var values []float64
+	if s, ok := src.(*TypedArray); ok {
+		// Read everything first, src may overlap a.
+		values = make([]float64, s.length)
+		for i := range values {
+			values[i] = s.at(i)
+		}
+	} else if arr, ok := arrayOf(src); ok {
+		values = make([]float64, arr.Len())
+		for i := range values {
+			values[i] = toNumber(arr.Index(i).Interface())
+		}
+	}
+
+	if start+len(values) > a.length {
+		return &Error{Message: "offset is out of bounds"}
+	}
+	for i, v := range values {
+		a.setAt(start+i, v)
+	}
+
+	return nil
+}
+
+func (a *TypedArray) String() string {
+	parts := make([]string, a.length)
+	for i := range parts {
+		parts[i] = numberString(a.at(i))
+	}
+	return strings.Join(parts, ",")
+}
+
+// relativeRange resolves the begin and end arguments of slice and subarray
+// for a sequence of n elements.
+func relativeRange(begin, end interface{}, n int) (int, int) {
+	resolve := func(v interface{}, def int) int {
+		if v == Undefined {
+			return def
+		}
+		f := math.Trunc(toNumber(v))
+		switch {
+		case math.IsNaN(f):
+			return 0
+		case f < 0:
+			return int(math.Max(float64(n)+f, 0))
+		}
+		return int(math.Min(f, float64(n)))
+	}
+
+	from, to := resolve(begin, 0), resolve(end, n)
+	if to < from {
+		to = from
+	}
+
+	return from, to
+}
+
+// newTypedArray implements the constructors of the typed arrays:
+// new T(length), new T(arrayOrTypedArray) and
+// new T(buffer, byteOffset, length).
+func newTypedArray(k *elementKind, args []interface{}) (*TypedArray, error) {
+	arg := func(i int) interface{} {
+		if i < len(args) {
+			return args[i]
+		}
+		return Undefined
+	}
+	name := k.name + "Array"
+
+	switch src := arg(0).(type) {
+	case *ArrayBuffer:
+		offset := 0
+		if arg(1) != Undefined {
+			offset = int(toNumber(arg(1)))
+		}
+		if offset < 0 || offset%k.size != 0 {
+			return nil, &Error{Message: fmt.Sprintf("start offset of %s should be a multiple of %d", name, k.size)}
+		}
+		if offset > len(src.data) {
+			return nil, &Error{Message: fmt.Sprintf("Start offset %d is outside the bounds of the buffer", offset)}
+		}
+
+		var length int
+		if arg(2) != Undefined {
+			length = int(toNumber(arg(2)))
+			if length < 0 || offset+length*k.size > len(src.data) {
+				return nil, &Error{Message: fmt.Sprintf("Invalid typed array length: %d", length)}
+			}
+		} else {
+			if (len(src.data)-offset)%k.size != 0 {
+				return nil, &Error{Message: fmt.Sprintf("byte length of %s should be a multiple of %d", name, k.size)}
+			}
+			length = (len(src.data) - offset) / k.size
+		}
+
+		return &TypedArray{kind: k, buffer: src, offset: offset, length: length}, nil
+
+	case *TypedArray:
+		a := allocTypedArray(k, src.length)
+		for i := 0; i < src.length; i++ {
+			a.setAt(i, src.at(i))
+		}
+		return a, nil
+	}
+
+	if arr, ok := arrayOf(arg(0)); ok {
+		a := allocTypedArray(k, arr.Len())
+		for i := 0; i < arr.Len(); i++ {
+			a.setAt(i, toNumber(arr.Index(i).Interface()))
+		}
+		return a, nil
+	}
+
+	length := 0.0
+	if arg(0) != Undefined {
+		length = toNumber(arg(0))
+	}
+	if length < 0 || length != math.Trunc(length) || length > math.MaxInt32 {
+		return nil, &Error{Message: fmt.Sprintf("Invalid typed array length: %s", numberString(length))}
+	}
+
+	return allocTypedArray(k, int(length)), nil
+}
+
+func allocTypedArray(k *elementKind, length int) *TypedArray {
+	return &TypedArray{
+		kind:   k,
+		buffer: NewArrayBuffer(make([]byte, length*k.size)),
+		length: length,
+	}
+}
+
+// DataView is a JavaScript DataView, which reads and writes numbers of any
+// type and byte order in an ArrayBuffer.
+type DataView struct {
+	buffer *ArrayBuffer
+	offset int
+	length int
+}
+
+func newDataView(buffer, byteOffset, byteLength interface{}) (*DataView, error) {
+	buf, ok := buffer.(*ArrayBuffer)
+	if !ok {
+		return nil, &Error{Message: "First argument to DataView constructor must be an ArrayBuffer"}
+	}
+
+	offset := 0
+	if byteOffset != Undefined {
+		offset = int(toNumber(byteOffset))
+	}
+	if offset < 0 || offset > len(buf.data) {
+		return nil, &Error{Message: fmt.Sprintf("Start offset %d is outside the bounds of the buffer", offset)}
+	}
+
+	length := len(buf.data) - offset
+	if byteLength != Undefined {
+		length = int(toNumber(byteLength))
+		if length < 0 || offset+length > len(buf.data) {
+			return nil, &Error{Message: fmt.Sprintf("Invalid DataView length %d", length)}
+		}
+	}
+
+	return &DataView{buffer: buf, offset: offset, length: length}, nil
+}
+
+func (v *DataView) get(key string) interface{} {
+	switch key {
+	case "buffer":
+		return v.buffer
+	case "byteLength":
+		return v.length
+	case "byteOffset":
+		return v.offset
+	}
+
+	if len(key) < 3 {
+		return Undefined
+	}
+	k := elementKindByName(key[3:])
+	if k == nil || k.name == "Uint8Clamped" {
+		return Undefined
+	}
+
+	switch key[:3] {
+	case "get":
+		return func(byteOffset float64, littleEndian bool) (float64, error) {
+			b, err := v.bytes(k, byteOffset)
+			if err != nil {
+				return 0, err
+			}
+			return k.get(b, byteOrder(littleEndian)), nil
+		}
+	case "set":
+		return func(byteOffset float64, value interface{}, littleEndian bool) error {
+			b, err := v.bytes(k, byteOffset)
+			if err != nil {
+				return err
+			}
+			k.set(b, byteOrder(littleEndian), toNumber(value))
+			return nil
+		}
+	}
+
+	return Undefined
+}
+
+// bytes returns the bytes of the value of kind k at byteOffset in the view.
+func (v *DataView) bytes(k *elementKind, byteOffset float64) ([]byte, error) {
+	off := int(byteOffset)
+	if byteOffset < 0 || off+k.size > v.length {
+		return nil, &Error{Message: "Offset is outside the bounds of the DataView"}
+	}
+
+	start := v.offset + off
+	return v.buffer.data[start : start+k.size], nil
+}
+
+// byteOrder returns the byte order DataView accessors use. They default to
+// big endian.
+func byteOrder(littleEndian bool) binary.ByteOrder {
+	if littleEndian {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// newBufferClasses returns ArrayBuffer, DataView and the typed array classes
+// keyed by name.
+func newBufferClasses() map[string]*Class {
+	classes := map[string]*Class{
+		"ArrayBuffer": {
+			Name: "ArrayBuffer",
+			New: func(length float64) (*ArrayBuffer, error) {
+				if length < 0 || length != math.Trunc(length) || length > math.MaxInt32 {
+					return nil, &Error{Message: "Invalid array buffer length"}
+				}
+				return NewArrayBuffer(make([]byte, int(length))), nil
+			},
+		},
+		"DataView": {
+			Name: "DataView",
+			New:  newDataView,
+		},
+	}
+
+	for _, k := range elementKinds {
+		k := k
+		classes[k.name+"Array"] = &Class{
+			Name: k.name + "Array",
+			New: func(args ...interface{}) (*TypedArray, error) {
+				return newTypedArray(k, args)
+			},
+			Static: map[string]interface{}{
+				"BYTES_PER_ELEMENT": k.size,
+			},
+			instance: func(v interface{}) bool {
+				a, ok := v.(*TypedArray)
+				return ok && a.kind == k
+			},
+		}
+	}
+
+	return classes
+}
@@ -0,0 +1,371 @@
+package wasmvm
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// FS is a filesystem the guest reaches through the fs module. Names are
+// absolute, slash separated and clean, as path.Clean returns them. Errors
+// reach the guest with the Node.js code of the *Error the methods return,
+// such as ENOENT or EEXIST; other errors become EIO.
+type FS interface {
+	// OpenFile opens the named file with flags made of os.O_* values,
+	// creating it with mode perm when os.O_CREATE is set. Directories can be
+	// opened read only, to be stated.
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	// Stat describes the named file, following symbolic links, and Lstat
+	// describes the link itself.
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	// ReadDir returns the names of the entries of the named directory,
+	// sorted.
+	ReadDir(name string) ([]string, error)
+	Mkdir(name string, perm os.FileMode) error
+	// Unlink removes a file that is not a directory, and Rmdir an empty
+	// directory.
+	Unlink(name string) error
+	Rmdir(name string) error
+	// Rename moves oldname to newname, replacing newname if it is a file or
+	// an empty directory.
+	Rename(oldname, newname string) error
+	Truncate(name string, size int64) error
+	Chmod(name string, mode os.FileMode) error
+	Chown(name string, uid, gid int) error
+	Lchown(name string, uid, gid int) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Link(oldname, newname string) error
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+}
+
+// File is a file opened by an FS. Reads and writes are positional: the guest
+// file descriptor keeps the offset, and writes to files opened with
+// os.O_APPEND are given the current size of the file.
+type File interface {
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Sync() error
+	Chmod(mode os.FileMode) error
+	Chown(uid, gid int) error
+}
+
+// FileStat is the Sys value of the os.FileInfo values an FS can return to
+// report the attributes os.FileInfo does not have. Without it the guest sees
+// the modification time for every time, a single link and the root user as
+// owner.
+type FileStat struct {
+	Dev   uint64
+	Ino   uint64
+	Nlink uint64
+	UID   int
+	GID   int
+	Atime time.Time
+	Ctime time.Time
+}
+
+// File type bits of the mode reported by stat, as in Node.js.
+const (
+	modeIFMT   = 0170000
+	modeIFSOCK = 0140000
+	modeIFLNK  = 0120000
+	modeIFREG  = 0100000
+	modeIFBLK  = 0060000
+	modeIFDIR  = 0040000
+	modeIFCHR  = 0020000
+	modeIFIFO  = 0010000
+)
+
+// Stats is the fs.Stats object the guest gets from stat, lstat and fstat.
+// Times are in milliseconds since the Unix epoch.
+type Stats struct {
+	Dev     int64
+	Ino     int64
+	Mode    int64
+	Nlink   int64
+	UID     int64
+	GID     int64
+	Rdev    int64
+	Size    int64
+	Blksize int64
+	Blocks  int64
+	AtimeMs int64
+	MtimeMs int64
+	CtimeMs int64
+}
+
+// IsDirectory reports whether the file is a directory.
+func (s *Stats) IsDirectory() bool {
+	return s.Mode&modeIFMT == modeIFDIR
+}
+
+// IsFile reports whether the file is a regular file.
+func (s *Stats) IsFile() bool {
+	return s.Mode&modeIFMT == modeIFREG
+}
+
+// IsSymbolicLink reports whether the file is a symbolic link.
+func (s *Stats) IsSymbolicLink() bool {
+	return s.Mode&modeIFMT == modeIFLNK
+}
+
+// newStats returns the Stats of the file fi describes.
+func newStats(fi os.FileInfo) *Stats {
+	const blksize = 4096
+
+	s := &Stats{
+		Mode:    unixMode(fi.Mode()),
+		Nlink:   1,
+		Size:    fi.Size(),
+		Blksize: blksize,
+		Blocks:  (fi.Size() + 511) / 512,
+		AtimeMs: milliseconds(fi.ModTime()),
+		MtimeMs: milliseconds(fi.ModTime()),
+		CtimeMs: milliseconds(fi.ModTime()),
+	}
+
+	if st, ok := fi.Sys().(*FileStat); ok {
+		s.Dev = int64(st.Dev)
+		s.Ino = int64(st.Ino)
+		s.Nlink = int64(st.Nlink)
+		s.UID = int64(st.UID)
+		s.GID = int64(st.GID)
+		if !st.Atime.IsZero() {
+			s.AtimeMs = milliseconds(st.Atime)
+		}
+		if !st.Ctime.IsZero() {
+			s.CtimeMs = milliseconds(st.Ctime)
+		}
+	}
+
+	return s
+}
+
+// milliseconds returns t in milliseconds since the Unix epoch, or 0 for the
+// zero time some filesystems report, like embed.FS.
+func milliseconds(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// unixMode converts m to the mode bits of stat.
+func unixMode(m os.FileMode) int64 {
+	mode := int64(m.Perm())
+
+	switch {
+	case m&os.ModeDir != 0:
+		mode |= modeIFDIR
+	case m&os.ModeSymlink != 0:
+		mode |= modeIFLNK
+	case m&os.ModeNamedPipe != 0:
+		mode |= modeIFIFO
+	case m&os.ModeSocket != 0:
+		mode |= modeIFSOCK
+	case m&os.ModeCharDevice != 0:
+		mode |= modeIFCHR
+	case m&os.ModeDevice != 0:
+		mode |= modeIFBLK
+	default:
+		mode |= modeIFREG
+	}
+
+	if m&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+
+	return mode
+}
+
+// fileMode converts the permission and special bits of a guest mode to an
+// os.FileMode.
+func fileMode(mode uint32) os.FileMode {
+	m := os.FileMode(mode & 0777)
+
+	if mode&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= os.ModeSticky
+	}
+
+	return m
+}
+
+// cleanPath returns the absolute FS name of the guest path name, which is
+// relative to the root directory when it is not absolute.
+func cleanPath(name string) string {
+	return path.Join("/", name)
+}
+
+// resolveLinks returns the clean name with the symbolic links it goes
+// through replaced by their targets, except for the last element of name
+// when follow is false. lstat and readlink describe and read the files of the
+// filesystem whose names are resolved, and absolute targets are names of it.
+// Missing files are left for the caller to report.
+func resolveLinks(name string, follow bool, lstat func(string) (os.FileInfo, error), readlink func(string) (string, error)) (string, error) {
+	rest := strings.Split(name, "/")
+	dir := "/"
+	links := 0
+
+	for len(rest) > 0 {
+		elem := rest[0]
+		rest = rest[1:]
+		if elem == "" || elem == "." {
+			continue
+		}
+
+		// The directories of dir are not links, so ".." is lexical.
+		next := path.Join(dir, elem)
+		if elem == ".." || (len(rest) == 0 && !follow) {
+			dir = next
+			continue
+		}
+
+		fi, err := lstat(next)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			dir = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", errno("ELOOP")
+		}
+		target, err := readlink(next)
+		if err != nil {
+			return "", err
+		}
+
+		if path.IsAbs(target) {
+			dir = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+
+	return dir, nil
+}
+
+// relativePath returns the relative path leading from the directory dir to
+// name. Both are clean and absolute.
+func relativePath(dir, name string) string {
+	from := strings.Split(strings.TrimPrefix(dir, "/"), "/")
+	to := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if dir == "/" {
+		from = nil
+	}
+	if name == "/" {
+		to = nil
+	}
+
+	common := 0
+	for common < len(from) && common < len(to) && from[common] == to[common] {
+		common++
+	}
+
+	var elems []string
+	for range from[common:] {
+		elems = append(elems, "..")
+	}
+	elems = append(elems, to[common:]...)
+	if len(elems) == 0 {
+		return "."
+	}
+
+	return strings.Join(elems, "/")
+}
+
+// fileInfo is an os.FileInfo made of its values.
+type fileInfo struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+	stat  FileStat
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time { return fi.mtime }
+func (fi *fileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}   { return &fi.stat }
+
+// mkdirAll creates the directory dir in fs with its missing parents, like
+// os.MkdirAll.
+func mkdirAll(fs FS, dir string, perm os.FileMode) error {
+	fi, err := fs.Stat(dir)
+	if err == nil {
+		if !fi.IsDir() {
+			return errno("ENOTDIR")
+		}
+		return nil
+	}
+	if fsError(err).Code != "ENOENT" {
+		return err
+	}
+
+	if err := mkdirAll(fs, path.Dir(dir), perm); err != nil {
+		return err
+	}
+
+	return fs.Mkdir(dir, perm)
+}
+
+// removeAll removes name from fs with everything it holds, like os.RemoveAll.
+func removeAll(fs FS, name string) error {
+	fi, err := fs.Lstat(name)
+	if err != nil {
+		if fsError(err).Code == "ENOENT" {
+			return nil
+		}
+		return err
+	}
+	if !fi.IsDir() {
+		return fs.Unlink(name)
+	}
+
+	names, err := fs.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := removeAll(fs, path.Join(name, n)); err != nil {
+			return err
+		}
+	}
+
+	return fs.Rmdir(name)
+}
+
+// copyFileTo writes the contents of the file name of fs to w.
+func copyFileTo(w io.Writer, fs FS, name string) error {
+	f, err := fs.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, io.NewSectionReader(f, 0, fi.Size()))
+	return err
+}
@@ -1,130 +1,35 @@
-package main
+package wasmvm
 
 import (
 	"encoding/binary"
 	"fmt"
 	"github.com/go-interpreter/wagon/exec"
-	"io"
 	"math"
-	"os"
 	"reflect"
-	"runtime/debug"
-	"strings"
 	"syscall"
 	"time"
 )
 
 const nanHead = 0x7FF80000
 
-var global = map[string]interface{}{
-	"fs":         fsImport,
-	"process":    importProcess,
-	"Uint8Array": importUint8Array,
-}
-var scope = map[string]interface{}{
-	"exited":        false,
-	"_pendingEvent": nil,
-}
-
-func init() {
-	// scope["_makeFuncWrapper"] = _makeFuncWrapper
-}
-func _makeFuncWrapper(id float64) func(args ...interface{}) []interface{} {
-	return func(args ...interface{}) []interface{} {
-		event := wasmEvent{Id: id, Args: args}
-		scope["_pendingEvent"] = event
-		scope["_resume"].(func())()
-
-		return event.Result
-	}
-}
-
-var storedValues = map[int]interface{}{
-	0: math.NaN(),
-	1: 0,
-	2: nil,
-	3: true,
-	4: false,
-	5: global,
-	6: scope,
-}
-var storedIds = map[interface{}]int{}
-var idpool = []int{}
-var goRefCounts = map[int]int{}
-
-func StoreAsMemoryObject(proc *exec.Process, addr int64, val interface{}) {
+func (inst *Instance) storeRef(proc *exec.Process, addr int64, val interface{}) {
 	data := make([]byte, 8)
-	memObj := makeMemoryObject(val)
-	hashValue := memObj.id
-	id, ok := storedIds[hashValue]
-	if !ok {
-		if len(idpool) > 0 {
-			id = idpool[len(idpool)-1]
-			idpool = idpool[:len(idpool)-1]
-		} else {
-			id = len(storedValues)
-		}
-		storedValues[id] = memObj
-		goRefCounts[id] = 0
-		storedIds[hashValue] = id
-	}
+	id := inst.refs.ref(val)
 
-	goRefCounts[id]++
-	typeFlag := 1 // Object
+	binary.LittleEndian.PutUint32(data[4:], nanHead|typeFlagOf(val))
+	binary.LittleEndian.PutUint32(data[:4], id)
 
-	binary.LittleEndian.PutUint32(data[4:], uint32(nanHead|typeFlag))
-	binary.LittleEndian.PutUint32(data[:4], uint32(id))
-
-	//fmt.Printf("stored as memobj %v in %d\n", val, id)
 	_, _ = proc.WriteAt(data, addr)
 }
 
-func StoreObject(proc *exec.Process, addr int64, val interface{}) {
-	typeName := reflect.TypeOf(val).String()
-	if strings.Contains(typeName, "map") ||
-		strings.Contains(typeName, "func") ||
-		strings.Contains(typeName, "uint8array") ||
-		strings.Contains(typeName, "interface") ||
-		strings.Contains(typeName, "wasmEvent") {
-		StoreAsMemoryObject(proc, addr, val)
-		return
-	}
-
-	data := make([]byte, 8)
-	fmt.Printf("TypeName: %s\n", typeName)
-	id, ok := storedIds[val]
-	if !ok {
-		if len(idpool) > 0 {
-			id = idpool[len(idpool)-1]
-			idpool = idpool[:len(idpool)-1]
-		} else {
-			id = len(storedValues)
-		}
-		storedValues[id] = val
-		goRefCounts[id] = 0
-		storedIds[val] = id
-	}
-
-	goRefCounts[id]++
-	typeFlag := 1
+func (inst *Instance) storeValue(proc *exec.Process, addr int64, v interface{}) {
+	tmp := make([]byte, 8)
 
-	switch reflect.TypeOf(val).Kind().String() {
-	case "string":
-		typeFlag = 2
-	case "func":
-		typeFlag = 4
+	if v == Undefined {
+		_, _ = proc.WriteAt(tmp, addr)
+		return
 	}
 
-	binary.LittleEndian.PutUint32(data[4:], uint32(nanHead|typeFlag))
-	binary.LittleEndian.PutUint32(data[:4], uint32(id))
-
-	//fmt.Printf("stored data %v in %d\n", val, id)
-	_, _ = proc.WriteAt(data, addr)
-}
-
-func StoreValue(proc *exec.Process, addr int64, v interface{}) {
-	tmp := make([]byte, 8)
-
 	if v == nil {
 		binary.LittleEndian.PutUint32(tmp[4:], nanHead)
 		binary.LittleEndian.PutUint32(tmp[:4], 2)
@@ -134,19 +39,19 @@ func StoreValue(proc *exec.Process, addr int64, v interface{}) {
 
 	switch vi := v.(type) {
 	case int:
-		StoreValue(proc, addr, float64(vi))
+		inst.storeValue(proc, addr, float64(vi))
 	case int32:
-		StoreValue(proc, addr, float64(vi))
+		inst.storeValue(proc, addr, float64(vi))
 	case int64:
-		StoreValue(proc, addr, float64(vi))
+		inst.storeValue(proc, addr, float64(vi))
 	case uint:
-		StoreValue(proc, addr, float64(vi))
+		inst.storeValue(proc, addr, float64(vi))
 	case uint32:
-		StoreValue(proc, addr, float64(vi))
+		inst.storeValue(proc, addr, float64(vi))
 	case uint64:
-		StoreValue(proc, addr, float64(vi))
+		inst.storeValue(proc, addr, float64(vi))
 	case float32:
-		StoreValue(proc, addr, float64(vi))
+		inst.storeValue(proc, addr, float64(vi))
 	case float64:
 		if math.IsNaN(vi) {
 			binary.LittleEndian.PutUint32(tmp[4:], nanHead)
@@ -173,33 +78,25 @@ func StoreValue(proc *exec.Process, addr int64, v interface{}) {
 		}
 		_, _ = proc.WriteAt(tmp, addr)
 	default:
-		StoreObject(proc, addr, vi)
+		inst.storeRef(proc, addr, vi)
 	}
 }
 
-func LoadValue(proc *exec.Process, p int32) (interface{}, int) {
+func (inst *Instance) loadValue(proc *exec.Process, p int32) interface{} {
 	f := getFloat64(proc, p)
 
 	if f == 0 {
-		return nil, -1
+		return Undefined
 	}
 
 	if !math.IsNaN(f) {
-		return f, -1
+		return f
 	}
 
-	id := int(getUInt32(proc, p))
-
-	v := storedValues[id]
-
-	if memObj, ok := v.(memoryObject); ok {
-		v = memObj.value
-	}
-
-	return v, id
+	return inst.refs.get(getUInt32(proc, p))
 }
 
-func LoadString(proc *exec.Process, p int32) string {
+func loadString(proc *exec.Process, p int32) string {
 	saddr := getUInt64(proc, p)
 	l := getUInt64(proc, p+8)
 
@@ -209,19 +106,19 @@ func LoadString(proc *exec.Process, p int32) string {
 	return string(data)
 }
 
-func LoadSliceOfValues(proc *exec.Process, p int32) []interface{} {
+func (inst *Instance) loadSliceOfValues(proc *exec.Process, p int32) []interface{} {
 	arrayPtr := getUInt64(proc, p)
 	arrayLen := int(getUInt64(proc, p+8))
 	values := make([]interface{}, arrayLen)
 
 	for i := 0; i < arrayLen; i++ {
-		values[i], _ = LoadValue(proc, int32(arrayPtr+uint64(i*8)))
+		values[i] = inst.loadValue(proc, int32(arrayPtr+uint64(i*8)))
 	}
 
 	return values
 }
 
-func LoadSlice(proc *exec.Process, p int32) []byte {
+func loadSlice(proc *exec.Process, p int32) []byte {
 	arrayPtr := getUInt64(proc, p)
 	arrayLen := getUInt64(proc, p+8)
 
@@ -233,23 +130,26 @@ func LoadSlice(proc *exec.Process, p int32) []byte {
 
 type GoHostFunc func(proc *exec.Process, p int32)
 
-func _debug(proc *exec.Process, p int32) {
-	s := LoadString(proc, p)
-	fmt.Printf("DEBUG(%d): %s\n", p, s)
+// _debug logs its argument to the standard output, like console.log does in
+// wasm_exec.js.
+func (inst *Instance) _debug(proc *exec.Process, p int32) {
+	_, _ = fmt.Fprintln(stdWriter{inst, 1}, p)
 }
 
-func resetMemoryDataView(proc *exec.Process, p int32) {
-	fmt.Printf("ResetMemoryDataView(%d)\n", p)
-}
+func (inst *Instance) resetMemoryDataView(proc *exec.Process, p int32) {}
 
-func wasmExit(proc *exec.Process, p int32) {
-	fmt.Printf("WasmExit(%d)\n", p)
-	// runtime.wasmExit
-}
+// wasmExit ends the guest with the exit code at sp+8. Like wasm_exec.js, it
+// drops the references of the guest; the VM stops right away.
+func (inst *Instance) wasmExit(proc *exec.Process, sp int32) {
+	inst.exitCode = int(int32(getUInt32(proc, sp+8)))
+	inst.scope["exited"] = true
+	inst.refs = newRefTable(inst.global, inst.scope)
+	inst.flushOutput()
 
-func wasmWrite(proc *exec.Process, sp int32) {
-	//fmt.Printf("WasmWrite(%d)\n", sp)
+	proc.Terminate()
+}
 
+func (inst *Instance) wasmWrite(proc *exec.Process, sp int32) {
 	data := make([]byte, 8)
 
 	_, _ = proc.ReadAt(data, int64(sp+8))
@@ -261,310 +161,301 @@ func wasmWrite(proc *exec.Process, sp int32) {
 	_, _ = proc.ReadAt(data[:4], int64(sp+24))
 	n := binary.LittleEndian.Uint32(data)
 
-	var w io.Writer
-
-	switch fd {
-	case uint64(syscall.Stdout):
-		w = os.Stdout
-	case uint64(syscall.Stderr):
-		w = os.Stderr
-	case uint64(syscall.Stdin):
-		w = os.Stdin
-	default:
-		fmt.Printf("No such FD: %d\n", fd)
+	// Like wasm_exec.js, only the standard output and error can be written.
+	if fd != uint64(syscall.Stdout) && fd != uint64(syscall.Stderr) {
 		return
 	}
+
 	data = make([]byte, n)
 	_, _ = proc.ReadAt(data, int64(p))
 
-	_, _ = fmt.Fprint(w, string(data))
+	_, _ = stdWriter{inst, int(fd)}.Write(data)
+}
+
+// now returns the time of the guest in nanoseconds since the Unix epoch. Like
+// the nanotime of wasm_exec.js, it is the wall time when Run started plus the
+// monotonic time elapsed since, so the wall time and monotonic time of the
+// guest move together.
+func (inst *Instance) now() int64 {
+	return inst.start.UnixNano() + int64(inst.clock.Now().Sub(inst.start))
 }
 
-func nanotime1(proc *exec.Process, p int32) {
-	//fmt.Printf("nanotime1(%d)\n", p)
+func (inst *Instance) nanotime1(proc *exec.Process, p int32) {
 	data := make([]byte, 8)
-	v := time.Now().UnixNano()
-	binary.LittleEndian.PutUint64(data, uint64(v))
+	binary.LittleEndian.PutUint64(data, uint64(inst.now()))
 
 	_, _ = proc.WriteAt(data, int64(p)+8)
 }
 
-func walltime1(proc *exec.Process, p int32) {
-	//fmt.Printf("walltime1(%d)\n", p)
+// walltime1 stores the seconds and nanoseconds of the time of the guest.
+func (inst *Instance) walltime1(proc *exec.Process, p int32) {
+	ns := inst.now()
+
 	data := make([]byte, 8)
-	msec := time.Now().UnixNano() / 1e3
-	binary.LittleEndian.PutUint64(data, uint64(msec)/1000)
+	binary.LittleEndian.PutUint64(data, uint64(ns/1e9))
 	_, _ = proc.WriteAt(data, int64(p)+8)
-	binary.LittleEndian.PutUint32(data, (uint32(msec%1000))*1000000)
+	binary.LittleEndian.PutUint32(data, uint32(ns%1e9))
 	_, _ = proc.WriteAt(data[:4], int64(p)+16)
 }
 
-func scheduleTimeoutEvent(proc *exec.Process, p int32) {
-	fmt.Printf("scheduleTimeoutEvent(%d)\n", p)
+func (inst *Instance) scheduleTimeoutEvent(proc *exec.Process, p int32) {
+	delay := time.Duration(getInt64(proc, p+8)) * time.Millisecond
+	id := inst.events.schedule(inst.clock.Now().Add(delay))
+	setInt32(proc, p+16, id)
 }
 
-func clearTimeoutEvent(proc *exec.Process, p int32) {
-	fmt.Printf("clearTimeoutEvent(%d)\n", p)
+func (inst *Instance) clearTimeoutEvent(proc *exec.Process, p int32) {
+	inst.events.clear(int32(getUInt32(proc, p+8)))
 }
 
-func getRandomData(proc *exec.Process, p int32) {
-	//fmt.Printf("getRandomData(%d)\n", p)
+// getRandomData fills the byte slice at p+8 from the entropy source.
+func (inst *Instance) getRandomData(proc *exec.Process, p int32) {
+	data := loadSlice(proc, p+8)
+	inst.readRandom(data)
+	_, _ = proc.WriteAt(data, int64(getUInt64(proc, p+8)))
 }
 
-func finalizeRef(proc *exec.Process, p int32) {
-	//fmt.Printf("finalizeRef(%d)\n", p)
-	data := make([]byte, 4)
-	_, _ = proc.ReadAt(data, int64(p)+8)
-
-	id := int(binary.LittleEndian.Uint32(data))
-	if _, ok := goRefCounts[id]; ok {
-		goRefCounts[id]--
-		if goRefCounts[id] == 0 {
-			v := storedValues[id]
-			storedValues[id] = nil
-			delete(storedIds, v)
-			idpool = append(idpool, id)
-		}
-	}
+func (inst *Instance) finalizeRef(proc *exec.Process, p int32) {
+	inst.refs.finalize(getUInt32(proc, p+8))
 }
 
-func stringVal(proc *exec.Process, p int32) {
-	//fmt.Printf("stringVal(%d)\n", p)
-	StoreValue(proc, int64(p)+24, LoadString(proc, p+8))
+func (inst *Instance) stringVal(proc *exec.Process, p int32) {
+	inst.storeValue(proc, int64(p)+24, loadString(proc, p+8))
 }
 
-func valueGet(proc *exec.Process, p int32) {
-	// fmt.Printf("valueGet(%08x)\n", p)
-	obj, _ := LoadValue(proc, p+8)
-	key := LoadString(proc, p+16)
+func (inst *Instance) valueGet(proc *exec.Process, p int32) {
+	obj := inst.loadValue(proc, p+8)
+	key := loadString(proc, p+16)
 
-	//fmt.Printf("Get %s \n", key)
+	inst.storeValue(proc, int64(p)+32, property(obj, key))
+}
 
-	if obj != nil {
-		objVal := reflect.ValueOf(obj)
+func (inst *Instance) valueSet(proc *exec.Process, p int32) {
+	obj := inst.loadValue(proc, p+8)
+	key := loadString(proc, p+16)
+	x := inst.loadValue(proc, p+32)
 
-		if objVal.Type().String() == "map[string]interface {}" {
-			m := obj.(map[string]interface{})
-			v, ok := m[key]
-			if !ok {
-				StoreValue(proc, int64(p)+32, nil)
-				return
-			}
-			StoreValue(proc, int64(p)+32, v)
-			return
-		}
+	if o, ok := obj.(JSObject); ok {
+		o.Set(key, x)
+		return
+	}
 
-		fieldVal := objVal.FieldByName(key)
+	if !isObject(obj) {
+		return
+	}
 
-		if !fieldVal.IsValid() {
-			fieldVal = objVal.FieldByName(switchPublicPrivate(key))
+	objVal := reflect.ValueOf(obj)
+	if objVal.Kind() == reflect.Map {
+		v, err := convertValue(x, objVal.Type().Elem())
+		if err == nil {
+			objVal.SetMapIndex(reflect.ValueOf(key), v)
 		}
+		return
+	}
 
-		if !fieldVal.IsValid() {
-			StoreValue(proc, int64(p)+32, nil)
-			return
-		}
+	setStructProperty(obj, key, x)
+}
 
-		StoreValue(proc, int64(p)+32, fieldVal.Interface())
-	} else {
-		StoreValue(proc, int64(p)+32, nil)
+func (inst *Instance) valueDelete(proc *exec.Process, p int32) {
+	obj := inst.loadValue(proc, p+8)
+	key := loadString(proc, p+16)
+
+	switch o := obj.(type) {
+	case JSObject:
+		o.Delete(key)
+	case map[string]interface{}:
+		delete(o, key)
 	}
 }
 
-func valueSet(proc *exec.Process, p int32) {
-	fmt.Printf("valueSet(%d)\n", p)
-	obj, _ := LoadValue(proc, p+8)
-	key := LoadString(proc, p+16)
-	objs, _ := LoadValue(proc, p+8)
-
-	fmt.Printf("Setting %s\n", key)
+func (inst *Instance) valueIndex(proc *exec.Process, p int32) {
+	v := inst.loadValue(proc, p+8)
+	i := int(getInt64(proc, p+16))
 
-	if obj != nil {
-		objVal := reflect.ValueOf(obj)
-		fmt.Printf("Type: %s\n", objVal.Type().String())
-		if strings.Contains(objVal.Type().String(), "map[") {
-			objVal.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(objs))
-			return
-		}
+	inst.storeValue(proc, int64(p)+24, index(v, i))
+}
 
-		switch v := objs.(type) {
-		case string:
-			objVal.FieldByName(key).SetString(v)
-		case int64:
-			objVal.FieldByName(key).SetInt(v)
-		case float64:
-			objVal.FieldByName(key).SetFloat(v)
-		case bool:
-			objVal.FieldByName(key).SetBool(v)
-		case uint64:
-			objVal.FieldByName(key).SetUint(v)
-		default:
-			fmt.Printf("Unknown mapped type: %s", reflect.TypeOf(obj).Name())
-		}
-	}
+func (inst *Instance) valueSetIndex(proc *exec.Process, p int32) {
+	v := inst.loadValue(proc, p+8)
+	i := int(getInt64(proc, p+16))
+	x := inst.loadValue(proc, p+24)
 
+	// Like in sloppy mode JavaScript, failed assignments are ignored.
+	_ = inst.setIndex(getUInt32(proc, p+8), v, i, x)
 }
 
-func valueDelete(proc *exec.Process, p int32) {
-	fmt.Printf("valueDelete(%d)\n", p)
-}
+func (inst *Instance) valueCall(proc *exec.Process, p int32) {
+	v := inst.loadValue(proc, p+8)
+	name := loadString(proc, p+16)
+	args := inst.loadSliceOfValues(proc, p+32)
 
-func valueIndex(proc *exec.Process, p int32) {
-	fmt.Printf("valueIndex(%d)\n", p)
-}
+	var (
+		result interface{}
+		err    error
+	)
 
-func valueSetIndex(proc *exec.Process, p int32) {
-	fmt.Printf("valueSetIndex(%d)\n", p)
-}
+	calls := inst.calls
+	if o, ok := v.(JSObject); ok {
+		result, err = o.Call(name, args)
+	} else {
+		result, err = callFunc(property(v, name), v, args)
+	}
+	p = inst.stackPointer(p, calls)
 
-func valueCall(proc *exec.Process, p int32) {
-	//fmt.Printf("valueCall(%d)\n", p)
-	v, _ := LoadValue(proc, p+8)
-	mV := LoadString(proc, p+16)
-	args := LoadSliceOfValues(proc, p+32)
+	if err != nil {
+		inst.storeValue(proc, int64(p+56), jsError(err))
+		setUInt8(proc, p+64, 0)
+		return
+	}
 
-	fieldVal := reflect.ValueOf(v).MapIndex(reflect.ValueOf(mV))
+	inst.storeValue(proc, int64(p+56), result)
+	setUInt8(proc, p+64, 1)
+}
 
-	if fieldVal.IsValid() {
-		fieldVal = reflect.ValueOf(fieldVal.Interface())
-		//fmt.Printf("Calling %s from %+v with %+v\n", mV, v, args)
-		//fmt.Printf("Field Val: %+v\n", fieldVal)
-		//fmt.Printf("Calling %s\n", mV)
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Println("HOST: Recovered in f", r)
-				fmt.Println(string(debug.Stack()))
-				e := r.(string)
-				StoreValue(proc, int64(p+56), e)
-				setUInt8(proc, p+64, 0)
-			}
-		}()
+func (inst *Instance) valueInvoke(proc *exec.Process, p int32) {
+	v := inst.loadValue(proc, p+8)
+	args := inst.loadSliceOfValues(proc, p+16)
 
-		argsVal := make([]reflect.Value, len(args))
-		for i, v := range args {
-			if v == nil {
-				argsVal[i] = reflect.New(fieldVal.Type().In(i)).Elem()
-			} else {
-				argsVal[i] = reflect.ValueOf(v)
-				// fmt.Printf("Arg %d: %s (%v)\n", i, argsVal[i].Type().String(), v)
-			}
-		}
-		result := reflectValuesToInterface(fieldVal.Call(argsVal))
+	calls := inst.calls
+	result, err := callFunc(v, Undefined, args)
+	p = inst.stackPointer(p, calls)
 
-		//fmt.Printf("Result: %+v\n", result)
-		StoreValue(proc, int64(p+56), result)
-		setUInt8(proc, p+64, 1)
+	if err != nil {
+		inst.storeValue(proc, int64(p+40), jsError(err))
+		setUInt8(proc, p+48, 0)
+		return
 	}
-}
 
-func valueInvoke(proc *exec.Process, p int32) {
-	fmt.Printf("valueInvoke(%d)\n", p)
+	inst.storeValue(proc, int64(p+40), result)
+	setUInt8(proc, p+48, 1)
 }
 
-func valueNew(proc *exec.Process, p int32) {
-	//fmt.Printf("valueNew(%d)\n", p)
+func (inst *Instance) valueNew(proc *exec.Process, p int32) {
+	v := inst.loadValue(proc, p+8)
+	args := inst.loadSliceOfValues(proc, p+16)
 
-	lv, _ := LoadValue(proc, p+8)
-	args := LoadSliceOfValues(proc, p+16)
+	var (
+		result interface{}
+		err    error
+	)
 
-	//fmt.Printf("%+v\n", lv)
-	//fmt.Printf("%+v\n", args)
-
-	copiedValue := reflect.New(reflect.TypeOf(lv)).Interface()
+	calls := inst.calls
+	switch c := v.(type) {
+	case *Class:
+		result, err = c.construct(args)
+	case *Func:
+		err = &Error{Message: "functions created with js.FuncOf are not constructors"}
+	default:
+		if typeFlagOf(v) == typeFlagFunction {
+			result, err = callFunc(v, Undefined, args)
+		} else {
+			err = &Error{Message: fmt.Sprintf("%s is not a constructor", jsString(v))}
+		}
+	}
+	p = inst.stackPointer(p, calls)
 
-	switch v := copiedValue.(type) {
-	case *uint8array:
-		arrayLen := int(args[0].(float64))
-		v.data = make([]byte, arrayLen)
-		//fmt.Printf("Created new UInt8Array(%d)\n", arrayLen)
+	if err != nil {
+		inst.storeValue(proc, int64(p+40), jsError(err))
+		setUInt8(proc, p+48, 0)
+		return
 	}
 
-	StoreValue(proc, int64(p+40), copiedValue)
-	res := []byte{1}
-	_, _ = proc.WriteAt(res, int64(p+48))
+	inst.storeValue(proc, int64(p+40), result)
+	setUInt8(proc, p+48, 1)
 }
 
-func valueLength(proc *exec.Process, p int32) {
-	//fmt.Printf("valueLength(%d)\n", p)
-	v, _ := LoadValue(proc, p+8)
+func (inst *Instance) valueLength(proc *exec.Process, p int32) {
+	v := inst.loadValue(proc, p+8)
 	l := 0
-	switch castedV := v.(type) {
-	case []interface{}:
-		l = len(castedV)
-	case []float64:
-		l = len(castedV)
-	case []byte:
-		l = len(castedV)
-	case []int:
-		l = len(castedV)
-	case uint8array:
-		l = len(castedV.data)
-	case string:
-		l = len(castedV)
+
+	switch o := v.(type) {
+	case JSObject:
+		if n := toNumber(o.Get("length")); n > 0 {
+			l = int(n)
+		}
+	case *TypedArray:
+		l = o.Len()
+	default:
+		if a, ok := arrayOf(v); ok {
+			l = a.Len()
+		}
 	}
 
 	setInt64(proc, p+16, int64(l))
 }
 
-func valuePrepareString(proc *exec.Process, p int32) {
-	fmt.Printf("valuePrepareString(%d)\n", p)
-}
+func (inst *Instance) valuePrepareString(proc *exec.Process, p int32) {
+	str := []byte(jsString(inst.loadValue(proc, p+8)))
 
-func valueLoadString(proc *exec.Process, p int32) {
-	fmt.Printf("valueLoadString(%d)\n", p)
-	strI, _ := LoadValue(proc, p+8)
+	inst.storeValue(proc, int64(p)+16, str)
+	setInt64(proc, p+24, int64(len(str)))
+}
 
-	if str, ok := strI.(string); ok {
-		b := append([]byte(str), 0x00)
-		_, _ = proc.WriteAt(b, int64(p+16))
+func (inst *Instance) valueLoadString(proc *exec.Process, p int32) {
+	str, _ := inst.loadValue(proc, p+8).([]byte)
+	dst := getUInt64(proc, p+16)
+	n := getUInt64(proc, p+24)
 
-		return
+	if uint64(len(str)) < n {
+		n = uint64(len(str))
 	}
 
-	if str, ok := strI.([]byte); ok {
-		b := append(str, 0x00)
-		_, _ = proc.WriteAt(b, int64(p+16))
+	_, _ = proc.WriteAt(str[:n], int64(dst))
+}
 
-		return
+func (inst *Instance) valueInstanceOf(proc *exec.Process, p int32) {
+	v := inst.loadValue(proc, p+8)
+	c := inst.loadValue(proc, p+16)
+
+	var ok bool
+	if o, isObject := v.(JSObject); isObject {
+		ok = o.InstanceOf(c)
+	} else if class, isClass := c.(*Class); isClass {
+		ok = class.isInstance(v)
 	}
 
-	fmt.Printf("Invalid string at value. Type %s\n", reflect.TypeOf(strI).String())
-}
+	if ok {
+		setUInt8(proc, p+24, 1)
+		return
+	}
 
-func valueInstanceOf(proc *exec.Process, p int32) {
-	fmt.Printf("valueInstanceOf(%d)\n", p)
+	setUInt8(proc, p+24, 0)
 }
 
-func copyBytesToGo(proc *exec.Process, p int32) {
-	//fmt.Printf("copyBytesToGo(%d)\n", p)
+func (inst *Instance) copyBytesToGo(proc *exec.Process, p int32) {
+	dst := getUInt64(proc, p+8)
+	dstLen := getUInt64(proc, p+16)
+	src, ok := inst.loadValue(proc, p+32).(*TypedArray)
 
-	dst := LoadSlice(proc, p+8)
-	src, _ := LoadValue(proc, p+16)
-
-	if dstU8, ok := src.(*uint8array); ok {
-		copy(dst, dstU8.data)
-		setUInt64(proc, p+40, uint64(len(dst)))
-		setUInt8(proc, p+48, 1)
+	if !ok || !src.isBytes() {
+		setUInt8(proc, p+48, 0)
 		return
 	}
 
-	setUInt8(proc, p+48, 0)
-}
+	data := src.Bytes()
+	n := uint64(len(data))
+	if dstLen < n {
+		n = dstLen
+	}
+	_, _ = proc.WriteAt(data[:n], int64(dst))
 
-func copyBytesToJS(proc *exec.Process, p int32) {
-	// fmt.Printf("copyBytesToJS(%d)\n", p)
+	setUInt64(proc, p+40, n)
+	setUInt8(proc, p+48, 1)
+}
 
-	dst, _ := LoadValue(proc, p+8)
-	src := LoadSlice(proc, p+16)
+func (inst *Instance) copyBytesToJS(proc *exec.Process, p int32) {
+	dst, ok := inst.loadValue(proc, p+8).(*TypedArray)
+	src := loadSlice(proc, p+16)
 
-	if dstU8, ok := dst.(*uint8array); ok {
-		copy(dstU8.data, src)
-		setUInt64(proc, p+40, uint64(len(dstU8.data)))
-		setUInt8(proc, p+48, 1)
+	if !ok || !dst.isBytes() {
+		setUInt8(proc, p+48, 0)
 		return
 	}
 
-	setUInt8(proc, p+48, 0)
+	n := copy(dst.Bytes(), src)
+
+	setUInt64(proc, p+40, uint64(n))
+	setUInt8(proc, p+48, 1)
 }
 
 var funcNames = []string{
@@ -573,6 +464,7 @@ var funcNames = []string{
 	"runtime.resetMemoryDataView",
 	"runtime.nanotime1",
 	"runtime.walltime1",
+	"runtime.walltime",
 	"runtime.scheduleTimeoutEvent",
 	"runtime.clearTimeoutEvent",
 	"runtime.getRandomData",
@@ -595,30 +487,33 @@ var funcNames = []string{
 	"debug",
 }
 
-var funcs = map[string]GoHostFunc{
-	"runtime.wasmExit":              wasmExit,
-	"runtime.wasmWrite":             wasmWrite,
-	"runtime.resetMemoryDataView":   resetMemoryDataView,
-	"runtime.nanotime1":             nanotime1,
-	"runtime.walltime1":             walltime1,
-	"runtime.scheduleTimeoutEvent":  scheduleTimeoutEvent,
-	"runtime.clearTimeoutEvent":     clearTimeoutEvent,
-	"runtime.getRandomData":         getRandomData,
-	"syscall/js.finalizeRef":        finalizeRef,
-	"syscall/js.stringVal":          stringVal,
-	"syscall/js.valueGet":           valueGet,
-	"syscall/js.valueSet":           valueSet,
-	"syscall/js.valueDelete":        valueDelete,
-	"syscall/js.valueIndex":         valueIndex,
-	"syscall/js.valueSetIndex":      valueSetIndex,
-	"syscall/js.valueCall":          valueCall,
-	"syscall/js.valueInvoke":        valueInvoke,
-	"syscall/js.valueNew":           valueNew,
-	"syscall/js.valueLength":        valueLength,
-	"syscall/js.valuePrepareString": valuePrepareString,
-	"syscall/js.valueLoadString":    valueLoadString,
-	"syscall/js.valueInstanceOf":    valueInstanceOf,
-	"syscall/js.copyBytesToGo":      copyBytesToGo,
-	"syscall/js.copyBytesToJS":      copyBytesToJS,
-	"debug":                         _debug,
+func (inst *Instance) hostFuncs() map[string]GoHostFunc {
+	return map[string]GoHostFunc{
+		"runtime.wasmExit":              inst.wasmExit,
+		"runtime.wasmWrite":             inst.wasmWrite,
+		"runtime.resetMemoryDataView":   inst.resetMemoryDataView,
+		"runtime.nanotime1":             inst.nanotime1,
+		"runtime.walltime1":             inst.walltime1,
+		"runtime.walltime":              inst.walltime1,
+		"runtime.scheduleTimeoutEvent":  inst.scheduleTimeoutEvent,
+		"runtime.clearTimeoutEvent":     inst.clearTimeoutEvent,
+		"runtime.getRandomData":         inst.getRandomData,
+		"syscall/js.finalizeRef":        inst.finalizeRef,
+		"syscall/js.stringVal":          inst.stringVal,
+		"syscall/js.valueGet":           inst.valueGet,
+		"syscall/js.valueSet":           inst.valueSet,
+		"syscall/js.valueDelete":        inst.valueDelete,
+		"syscall/js.valueIndex":         inst.valueIndex,
+		"syscall/js.valueSetIndex":      inst.valueSetIndex,
+		"syscall/js.valueCall":          inst.valueCall,
+		"syscall/js.valueInvoke":        inst.valueInvoke,
+		"syscall/js.valueNew":           inst.valueNew,
+		"syscall/js.valueLength":        inst.valueLength,
+		"syscall/js.valuePrepareString": inst.valuePrepareString,
+		"syscall/js.valueLoadString":    inst.valueLoadString,
+		"syscall/js.valueInstanceOf":    inst.valueInstanceOf,
+		"syscall/js.copyBytesToGo":      inst.copyBytesToGo,
+		"syscall/js.copyBytesToJS":      inst.copyBytesToJS,
+		"debug":                         inst._debug,
+	}
 }